@@ -0,0 +1,99 @@
+package ccache
+
+import (
+	"hash/fnv"
+	"math/rand"
+	"sync"
+)
+
+// An admitter (see Configuration.Admit) which rejects items whose size is
+// greater than max.
+func AdmitMaxSize[T any](max int64) func(key string, value T, size int64) bool {
+	return func(key string, value T, size int64) bool {
+		return size <= max
+	}
+}
+
+// An admitter (see Configuration.Admit) which only admits a key the second
+// time it's seen. Keys which are only ever set once (say, from a scan) never
+// make it into the cache. Sightings are recorded in a bloom filter sized for
+// capacity keys, which is reset after capacity keys have been recorded, so a
+// key's two sightings have to be reasonably close together. The filter can
+// have false positives, so a few keys are admitted on their first sighting.
+func AdmitOnSecondSighting[T any](capacity int) func(key string, value T, size int64) bool {
+	d := newDoorkeeper(capacity)
+	return func(key string, value T, size int64) bool {
+		return d.seen(key)
+	}
+}
+
+// An admitter (see Configuration.Admit) which admits a random sample of items,
+// each with the given probability (between 0 and 1).
+func AdmitSample[T any](probability float64) func(key string, value T, size int64) bool {
+	return func(key string, value T, size int64) bool {
+		return rand.Float64() < probability
+	}
+}
+
+const doorkeeperHashes = 4
+
+// A bloom filter which records keys, with ~10 bits per key (a false positive
+// rate around 1%).
+type doorkeeper struct {
+	sync.Mutex
+	bits     []uint64
+	count    int
+	capacity int
+}
+
+func newDoorkeeper(capacity int) *doorkeeper {
+	if capacity < 1 {
+		capacity = 1
+	}
+	words := (capacity*10 + 63) / 64
+	return &doorkeeper{
+		bits:     make([]uint64, words),
+		capacity: capacity,
+	}
+}
+
+// Records the key, returns true if it was (probably) already recorded
+func (d *doorkeeper) seen(key string) bool {
+	h := fnv.New64a()
+	h.Write([]byte(key))
+	sum := h.Sum64()
+	// double hashing: the i-th position is h1 + i*h2
+	h1, h2 := sum&0xffffffff, sum>>32
+	m := uint64(len(d.bits) * 64)
+
+	var positions [doorkeeperHashes]uint64
+	for i := range positions {
+		positions[i] = (h1 + uint64(i)*h2) % m
+	}
+
+	d.Lock()
+	defer d.Unlock()
+	if d.has(positions) {
+		return true
+	}
+	if d.count >= d.capacity {
+		for i := range d.bits {
+			d.bits[i] = 0
+		}
+		d.count = 0
+	}
+	for _, bit := range positions {
+		d.bits[bit/64] |= 1 << (bit % 64)
+	}
+	d.count += 1
+	return false
+}
+
+func (d *doorkeeper) has(positions [doorkeeperHashes]uint64) bool {
+	for _, bit := range positions {
+		if d.bits[bit/64]&(1<<(bit%64)) == 0 {
+			return false
+		}
+	}
+	return true
+}
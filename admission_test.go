@@ -0,0 +1,55 @@
+package ccache
+
+import (
+	"strconv"
+	"testing"
+
+	"github.com/karlseguin/ccache/v3/assert"
+)
+
+func Test_AdmitMaxSize(t *testing.T) {
+	admit := AdmitMaxSize[int](10)
+	assert.True(t, admit("a", 1, 10))
+	assert.False(t, admit("a", 1, 11))
+}
+
+func Test_AdmitOnSecondSighting(t *testing.T) {
+	admit := AdmitOnSecondSighting[int](1000)
+	assert.False(t, admit("a", 1, 1))
+	assert.True(t, admit("a", 1, 1))
+	assert.True(t, admit("a", 1, 1))
+	assert.False(t, admit("b", 1, 1))
+
+	falsePositives := 0
+	for i := 0; i < 900; i++ {
+		if admit(strconv.Itoa(i), 1, 1) {
+			falsePositives += 1
+		}
+	}
+	assert.True(t, falsePositives < 30)
+}
+
+func Test_AdmitOnSecondSightingResets(t *testing.T) {
+	admit := AdmitOnSecondSighting[int](10)
+	assert.False(t, admit("a", 1, 1))
+	for i := 0; i < 10; i++ {
+		admit(strconv.Itoa(i), 1, 1)
+	}
+	// forgotten
+	assert.False(t, admit("a", 1, 1))
+	assert.True(t, admit("a", 1, 1))
+}
+
+func Test_AdmitSample(t *testing.T) {
+	assert.False(t, AdmitSample[int](0)("a", 1, 1))
+	assert.True(t, AdmitSample[int](1)("a", 1, 1))
+
+	admit := AdmitSample[int](0.5)
+	admitted := 0
+	for i := 0; i < 10000; i++ {
+		if admit("a", 1, 1) {
+			admitted += 1
+		}
+	}
+	assert.True(t, admitted > 4000 && admitted < 6000)
+}
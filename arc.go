@@ -0,0 +1,181 @@
+package ccache
+
+import (
+	"container/list"
+	"strings"
+)
+
+// Adaptive Replacement Cache (see Configuration.ARC). Items start in a
+// "recent" list (t1), and move to a "frequent" list (t2) when they're
+// promoted. Items evicted from either list leave a ghost (their key and size)
+// in b1 or b2. target is the size that t1 should have: eviction takes from t1
+// when it's over target, and from t2 otherwise. When a key which was evicted
+// comes back, its ghost tells us which list was too small: a b1 hit grows the
+// target, a b2 hit shrinks it. Either way, the item goes straight to t2.
+//
+// Items which are only seen once (say, by a scan) never leave t1, so they
+// can't push the frequent items out.
+type arc[T any] struct {
+	t1, t2         *List[T]
+	t1Size, t2Size int64
+	b1, b2         *list.List
+	b1Size, b2Size int64
+	ghosts         map[arcKey]*list.Element
+	target         int64
+}
+
+// The LayeredCache's items are identified by their primary and secondary key,
+// the HierarchicalCache's by their path (the keys before the last one are
+// joined into group)
+type arcKey struct {
+	group string
+	key   string
+}
+
+func newARCKey[T any](item *Item[T]) arcKey {
+	if path := item.path(); len(path) > 1 {
+		return arcKey{strings.Join(path[:len(path)-1], "\x00"), item.key}
+	}
+	return arcKey{item.group, item.key}
+}
+
+type arcGhost struct {
+	key      arcKey
+	size     int64
+	frequent bool
+}
+
+func newARC[T any]() evictionPolicy[T] {
+	return &arc[T]{
+		t1:     NewList[T](),
+		t2:     NewList[T](),
+		b1:     list.New(),
+		b2:     list.New(),
+		ghosts: make(map[arcKey]*list.Element),
+	}
+}
+
+// item.state.frequency is 1 for items in t1, 2 for items in t2
+func (a *arc[T]) insert(item *Item[T]) {
+	e := a.ghosts[newARCKey(item)]
+	if e == nil {
+		item.workerState().frequency = 1
+		a.t1.Insert(item)
+		a.t1Size += item.size
+		return
+	}
+
+	ghost := a.removeGhost(e)
+	if ghost.frequent {
+		delta := item.size
+		if a.b2Size > 0 && a.b1Size > a.b2Size {
+			delta = item.size * a.b1Size / a.b2Size
+		}
+		a.target = max(a.target-delta, 0)
+	} else {
+		delta := item.size
+		if a.b1Size > 0 && a.b2Size > a.b1Size {
+			delta = item.size * a.b2Size / a.b1Size
+		}
+		a.target = min(a.target+delta, a.t1Size+a.t2Size+item.size)
+	}
+	item.workerState().frequency = 2
+	a.t2.Insert(item)
+	a.t2Size += item.size
+}
+
+func (a *arc[T]) promote(item *Item[T]) {
+	if item.state.frequency == 2 {
+		a.t2.MoveToFront(item)
+		return
+	}
+	a.t1.Remove(item)
+	a.t1Size -= item.size
+	item.state.frequency = 2
+	a.t2.Insert(item)
+	a.t2Size += item.size
+}
+
+func (a *arc[T]) remove(item *Item[T]) {
+	if item.state.frequency == 2 {
+		a.t2.Remove(item)
+		a.t2Size -= item.size
+	} else {
+		a.t1.Remove(item)
+		a.t1Size -= item.size
+	}
+}
+
+func (a *arc[T]) victims(fn func(item *Item[T]) bool) {
+	// the next candidate of each list; items which fn doesn't evict are
+	// skipped over
+	c1, c2 := a.t1.Tail, a.t2.Tail
+	for {
+		var item *Item[T]
+		if c1 != nil && (c2 == nil || a.t1Size > a.target) {
+			item, c1 = c1, c1.prev
+		} else if c2 != nil {
+			item, c2 = c2, c2.prev
+		} else {
+			return
+		}
+
+		frequent := item.state.frequency == 2
+		keepGoing := fn(item)
+		if !item.inList {
+			a.addGhost(item, frequent)
+		}
+		if !keepGoing {
+			return
+		}
+	}
+}
+
+func (a *arc[T]) keepers(fn func(item *Item[T]) bool) {
+	for _, l := range []*List[T]{a.t2, a.t1} {
+		for item := l.Head; item != nil; item = item.next {
+			if !fn(item) {
+				return
+			}
+		}
+	}
+}
+
+func (a *arc[T]) addGhost(item *Item[T], frequent bool) {
+	key := newARCKey(item)
+	if e := a.ghosts[key]; e != nil {
+		a.removeGhost(e)
+	}
+
+	ghost := &arcGhost{key: key, size: item.size, frequent: frequent}
+	if frequent {
+		a.ghosts[key] = a.b2.PushFront(ghost)
+		a.b2Size += item.size
+	} else {
+		a.ghosts[key] = a.b1.PushFront(ghost)
+		a.b1Size += item.size
+	}
+
+	// Ghosts are kept for, at most, as much as the cache holds. Like ARC's
+	// |t1| + |b1| <= c, b1 is trimmed first when it outgrows t2.
+	for a.b1Size+a.b2Size > a.t1Size+a.t2Size {
+		if a.b1.Len() > 0 && (a.b2.Len() == 0 || a.b1Size > a.t2Size) {
+			a.removeGhost(a.b1.Back())
+		} else {
+			a.removeGhost(a.b2.Back())
+		}
+	}
+}
+
+func (a *arc[T]) removeGhost(e *list.Element) *arcGhost {
+	ghost := e.Value.(*arcGhost)
+	delete(a.ghosts, ghost.key)
+	if ghost.frequent {
+		a.b2.Remove(e)
+		a.b2Size -= ghost.size
+	} else {
+		a.b1.Remove(e)
+		a.b1Size -= ghost.size
+	}
+	return ghost
+}
@@ -0,0 +1,128 @@
+package ccache
+
+import (
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/karlseguin/ccache/v3/assert"
+)
+
+func Test_ARC_EvictsRecentItemsFirst(t *testing.T) {
+	a := newARC[int]().(*arc[int])
+	items := policyItems(a, 4)
+	a.promote(items[0])
+	a.promote(items[1])
+
+	assert.Equal(t, policyEvict(a), "2")
+	assert.Equal(t, policyEvict(a), "3")
+	assert.Equal(t, policyEvict(a), "0")
+	assert.Equal(t, a.t1Size, 0)
+	assert.Equal(t, a.t2Size, 1)
+}
+
+func Test_ARC_GhostHitsAdaptTarget(t *testing.T) {
+	a := newARC[int]().(*arc[int])
+	items := policyItems(a, 4)
+	a.promote(items[2])
+	a.promote(items[3])
+
+	assert.Equal(t, policyEvict(a), "0")
+	assert.Equal(t, a.b1.Len(), 1)
+
+	// 0 was evicted too early, t1 should be bigger
+	a.insert(newItem("0", 0, 0, false))
+	assert.Equal(t, a.target, 1)
+	assert.Equal(t, a.b1.Len(), 0)
+	assert.Equal(t, a.t2Size, 3)
+
+	// with t1 within its target, t2 is evicted
+	assert.Equal(t, policyEvict(a), "2")
+	assert.Equal(t, policyEvict(a), "3")
+	assert.Equal(t, a.b2.Len(), 2)
+
+	// 2 was evicted too early, t2 should be bigger
+	a.insert(newItem("2", 2, 0, false))
+	assert.Equal(t, a.target, 0)
+	assert.Equal(t, a.b2.Len(), 1)
+}
+
+func Test_ARC_GhostsAreBounded(t *testing.T) {
+	a := newARC[int]().(*arc[int])
+	items := policyItems(a, 10)
+	for _, item := range items[5:] {
+		a.promote(item)
+	}
+	for i := 0; i < 8; i++ {
+		policyEvict(a)
+	}
+	assert.Equal(t, a.t1Size+a.t2Size, 2)
+	assert.Equal(t, a.b1.Len()+a.b2.Len(), 2)
+	assert.Equal(t, len(a.ghosts), 2)
+}
+
+func Test_ARC_GhostsAreKeyedByGroup(t *testing.T) {
+	a := newARC[int]().(*arc[int])
+	item := newItem("key", 1, 0, false)
+	item.group = "a"
+	a.insert(item)
+	a.insert(newItem("other", 2, 0, false))
+	a.promote(a.t1.Head)
+	assert.Equal(t, policyEvict(a), "key")
+
+	other := newItem("key", 1, 0, false)
+	other.group = "b"
+	a.insert(other)
+	assert.Equal(t, other.state.frequency, 1)
+
+	item = newItem("key", 1, 0, false)
+	item.group = "a"
+	a.insert(item)
+	assert.Equal(t, item.state.frequency, 2)
+}
+
+func Test_CacheARCIsScanResistant(t *testing.T) {
+	cache := New(Configure[int]().MaxSize(10).PercentToPrune(10).GetsPerPromote(1).ARC())
+	defer cache.Stop()
+
+	for i := 0; i < 5; i++ {
+		cache.Set(strconv.Itoa(i), i, time.Minute)
+	}
+	cache.SyncUpdates()
+	for i := 0; i < 5; i++ {
+		cache.Get(strconv.Itoa(i))
+	}
+
+	for i := 0; i < 100; i++ {
+		cache.Set("scan:"+strconv.Itoa(i), i, time.Minute)
+		cache.SyncUpdates()
+	}
+	for i := 0; i < 5; i++ {
+		assert.Equal(t, cache.Get(strconv.Itoa(i)).Value(), i)
+	}
+	assert.Equal(t, cache.Get("scan:0"), nil)
+	assert.Equal(t, cache.Get("scan:99").Value(), 99)
+}
+
+func Test_LayeredCacheARCIsScanResistant(t *testing.T) {
+	cache := Layered(Configure[int]().MaxSize(10).PercentToPrune(10).GetsPerPromote(1).ARC())
+	defer cache.Stop()
+
+	for i := 0; i < 5; i++ {
+		cache.Set("hot", strconv.Itoa(i), i, time.Minute)
+	}
+	cache.SyncUpdates()
+	for i := 0; i < 5; i++ {
+		cache.Get("hot", strconv.Itoa(i))
+	}
+
+	for i := 0; i < 100; i++ {
+		cache.Set("scan", strconv.Itoa(i), i, time.Minute)
+		cache.SyncUpdates()
+	}
+	for i := 0; i < 5; i++ {
+		assert.Equal(t, cache.Get("hot", strconv.Itoa(i)).Value(), i)
+	}
+	assert.Equal(t, cache.Get("scan", "0"), nil)
+	assert.Equal(t, cache.Get("scan", "99").Value(), 99)
+}
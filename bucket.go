@@ -3,12 +3,33 @@ package ccache
 import (
 	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 )
 
 type bucket[T any] struct {
 	sync.RWMutex
 	lookup map[string]*Item[T]
+
+	// Only used by the LayeredCache: set (under the layeredBucket's write lock)
+	// when an empty bucket is removed from its layeredBucket. SecondaryCaches
+	// can still reference a reclaimed bucket, and use this to know they need
+	// to get the current one.
+	reclaimed int32
+
+	// Only used by the LayeredCache's generational mode: bumping the
+	// generation (under the write lock) invalidates every existing item.
+	generation uint64
+
+	// Notified, under the write lock, of every item added to or removed from
+	// lookup. Lets the cache keep secondary indexes (like tags) in sync with
+	// the lookup.
+	observers []bucketObserver[T]
+}
+
+type bucketObserver[T any] interface {
+	added(item *Item[T])
+	removed(item *Item[T])
 }
 
 func (b *bucket[T]) itemCount() int {
@@ -18,10 +39,9 @@ func (b *bucket[T]) itemCount() int {
 }
 
 func (b *bucket[T]) forEachFunc(matches func(key string, item *Item[T]) bool) bool {
-	lookup := b.lookup
 	b.RLock()
 	defer b.RUnlock()
-	for key, item := range lookup {
+	for key, item := range b.lookup {
 		if !matches(key, item) {
 			return false
 		}
@@ -29,6 +49,17 @@ func (b *bucket[T]) forEachFunc(matches func(key string, item *Item[T]) bool) bo
 	return true
 }
 
+// A snapshot of the bucket's items
+func (b *bucket[T]) items() []*Item[T] {
+	b.RLock()
+	defer b.RUnlock()
+	items := make([]*Item[T], 0, len(b.lookup))
+	for _, item := range b.lookup {
+		items = append(items, item)
+	}
+	return items
+}
+
 func (b *bucket[T]) get(key string) *Item[T] {
 	b.RLock()
 	defer b.RUnlock()
@@ -56,6 +87,7 @@ func (b *bucket[T]) setnx(key string, value T, duration time.Duration, track boo
 	}
 
 	b.lookup[key] = newItem
+	b.added(newItem)
 	return newItem
 }
 
@@ -80,54 +112,115 @@ func (b *bucket[T]) setnx2(key string, f func() T, duration time.Duration, track
 	newItem := newItem(key, f(), expires, track)
 
 	b.lookup[key] = newItem
+	b.added(newItem)
 	return newItem, false
 }
 
 func (b *bucket[T]) set(key string, value T, duration time.Duration, track bool) (*Item[T], *Item[T]) {
 	expires := time.Now().Add(duration).UnixNano()
 	item := newItem(key, value, expires, track)
+	return item, b.setItem(item)
+}
+
+// Stores the item (under its key) and returns the item it replaced, if any.
+func (b *bucket[T]) setItem(item *Item[T]) *Item[T] {
 	b.Lock()
-	existing := b.lookup[key]
-	b.lookup[key] = item
+	if b.generation != 0 {
+		item.extend().generation = b.generation
+	}
+	existing := b.lookup[item.key]
+	b.lookup[item.key] = item
+	if existing != nil {
+		b.removed(existing)
+	}
+	b.added(item)
 	b.Unlock()
-	return item, existing
+	return existing
 }
 
 func (b *bucket[T]) remove(key string) *Item[T] {
 	b.Lock()
 	item := b.lookup[key]
-	delete(b.lookup, key)
+	if item != nil {
+		delete(b.lookup, key)
+		b.removed(item)
+	}
 	b.Unlock()
 	return item
 }
 
+// Unlike remove, only removes the item if it's still the one stored under its
+// key (it could have been replaced since the caller got it).
+func (b *bucket[T]) removeItem(item *Item[T]) bool {
+	b.Lock()
+	defer b.Unlock()
+	if b.lookup[item.key] != item {
+		return false
+	}
+	delete(b.lookup, item.key)
+	b.removed(item)
+	return true
+}
+
 func (b *bucket[T]) delete(key string) {
 	b.Lock()
-	delete(b.lookup, key)
+	if item := b.lookup[key]; item != nil {
+		delete(b.lookup, key)
+		b.removed(item)
+	}
+	b.Unlock()
+}
+
+// Invalidates every item currently in the bucket, without touching them.
+func (b *bucket[T]) invalidate() {
+	b.Lock()
+	atomic.AddUint64(&b.generation, 1)
 	b.Unlock()
 }
 
+// Whether the item was invalidated by a call to invalidate
+func (b *bucket[T]) isStale(item *Item[T]) bool {
+	return item.generation() != atomic.LoadUint64(&b.generation)
+}
+
+// Removes, and returns, every item for which stale returns true
+func (b *bucket[T]) removeFunc(stale func(item *Item[T]) bool) []*Item[T] {
+	var items []*Item[T]
+	b.Lock()
+	for key, item := range b.lookup {
+		if stale(item) {
+			delete(b.lookup, key)
+			b.removed(item)
+			items = append(items, item)
+		}
+	}
+	b.Unlock()
+	return items
+}
+
+func (b *bucket[T]) isReclaimed() bool {
+	return atomic.LoadInt32(&b.reclaimed) == 1
+}
+
 // This is an expensive operation, so we do what we can to optimize it and limit
 // the impact it has on concurrent operations. Specifically, we:
 // 1 - Do an initial iteration to collect matches. This allows us to do the
 //     "expensive" prefix check (on all values) using only a read-lock
 // 2 - Do a second iteration, under write lock, for the matched results to do
-//     the actual deletion
+//     the actual deletion. Items which were replaced (or removed) since the
+//     first iteration are left alone.
+// 3 - Pass the removed items to deletables once no lock is held, so that a full
+//     deletables channel doesn't stall other operations on the bucket.
 
 // Also, this is the only place where the Bucket is aware of cache detail: the
 // deletables channel. Passing it here lets us avoid iterating over matched items
-// again in the cache. Further, we pass item to deletables BEFORE actually removing
-// the item from the map. I'm pretty sure this is 100% fine, but it is unique.
-// (We do this so that the write to the channel is under the read lock and not the
-// write lock)
+// again in the cache.
 func (b *bucket[T]) deleteFunc(matches func(key string, item *Item[T]) bool, deletables chan *Item[T]) int {
-	lookup := b.lookup
 	items := make([]*Item[T], 0)
 
 	b.RLock()
-	for key, item := range lookup {
+	for key, item := range b.lookup {
 		if matches(key, item) {
-			deletables <- item
 			items = append(items, item)
 		}
 	}
@@ -138,12 +231,21 @@ func (b *bucket[T]) deleteFunc(matches func(key string, item *Item[T]) bool, del
 		return 0
 	}
 
+	removed := items[:0]
 	b.Lock()
 	for _, item := range items {
-		delete(lookup, item.key)
+		if b.lookup[item.key] == item {
+			delete(b.lookup, item.key)
+			b.removed(item)
+			removed = append(removed, item)
+		}
 	}
 	b.Unlock()
-	return len(items)
+
+	for _, item := range removed {
+		deletables <- item
+	}
+	return len(removed)
 }
 
 func (b *bucket[T]) deletePrefix(prefix string, deletables chan *Item[T]) int {
@@ -156,6 +258,21 @@ func (b *bucket[T]) deletePrefix(prefix string, deletables chan *Item[T]) int {
 func (b *bucket[T]) clear() {
 	for _, item := range b.lookup {
 		item.promotions = -2
+		b.removed(item)
 	}
 	b.lookup = make(map[string]*Item[T])
 }
+
+// we expect the caller to have acquired a write lock
+func (b *bucket[T]) added(item *Item[T]) {
+	for _, o := range b.observers {
+		o.added(item)
+	}
+}
+
+// we expect the caller to have acquired a write lock
+func (b *bucket[T]) removed(item *Item[T]) {
+	for _, o := range b.observers {
+		o.removed(item)
+	}
+}
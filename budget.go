@@ -0,0 +1,152 @@
+package ccache
+
+import (
+	"sync"
+	"sync/atomic"
+)
+
+// A Budget is a max size shared by multiple caches (Cache and/or LayeredCache,
+// of any value type). Each cache is configured with the budget via
+// Configuration.Budget. When the total size of all the caches exceeds the
+// budget, the cache which is most over its fair share is asked to prune.
+
+// A cache's fair share is the budget's max size weighted by the cache's weight
+// relative to the weight of all of the budget's caches, but never less than the
+// cache's configured minimum. A cache is never pruned below its minimum because
+// of the budget.
+type Budget struct {
+	sync.Mutex
+	maxSize int64
+	size    int64
+	members []*budgetMember
+}
+
+type budgetMember struct {
+	budget  *Budget
+	weight  int64
+	minSize int64
+	size    int64
+	control control
+}
+
+// Creates a new budget with the given max size
+func NewBudget(maxSize int64) *Budget {
+	return &Budget{maxSize: maxSize}
+}
+
+// The total size of all of the budget's caches. Like a cache's GetSize, this
+// is eventually consistent.
+func (b *Budget) Size() int64 {
+	return atomic.LoadInt64(&b.size)
+}
+
+func (b *Budget) join(weight int64, minSize int64, cc control) *budgetMember {
+	if weight < 1 {
+		weight = 1
+	}
+	m := &budgetMember{
+		budget:  b,
+		weight:  weight,
+		minSize: minSize,
+		control: cc,
+	}
+	b.Lock()
+	b.members = append(b.members, m)
+	b.Unlock()
+	return m
+}
+
+func (b *Budget) leave(m *budgetMember) {
+	b.Lock()
+	for i, member := range b.members {
+		if member == m {
+			b.members = append(b.members[:i], b.members[i+1:]...)
+			break
+		}
+	}
+	b.Unlock()
+	m.setSize(0)
+}
+
+// Picks the member which is most over its fair share and which is above its
+// minimum. Returns nil if no member can be pruned.
+func (b *Budget) victim() *budgetMember {
+	b.Lock()
+	defer b.Unlock()
+
+	totalWeight := int64(0)
+	for _, m := range b.members {
+		totalWeight += m.weight
+	}
+
+	var victim *budgetMember
+	var victimExcess int64
+	for _, m := range b.members {
+		size := atomic.LoadInt64(&m.size)
+		if size <= m.minSize {
+			continue
+		}
+		excess := size - m.share(b.maxSize, totalWeight)
+		if victim == nil || excess > victimExcess {
+			victim = m
+			victimExcess = excess
+		}
+	}
+	return victim
+}
+
+func (m *budgetMember) share(maxSize int64, totalWeight int64) int64 {
+	share := maxSize * m.weight / totalWeight
+	if share < m.minSize {
+		return m.minSize
+	}
+	return share
+}
+
+// Only ever called by the member's own worker, which owns the cache's size.
+func (m *budgetMember) setSize(size int64) {
+	delta := size - atomic.LoadInt64(&m.size)
+	if delta == 0 {
+		return
+	}
+	atomic.StoreInt64(&m.size, size)
+	atomic.AddInt64(&m.budget.size, delta)
+}
+
+// Called by the member's worker after its cache grew. Returns true if the
+// budget is exceeded and this member should prune itself. If another member
+// should prune, it's signaled (without blocking) and false is returned.
+func (m *budgetMember) full(size int64) bool {
+	m.setSize(size)
+	b := m.budget
+	if atomic.LoadInt64(&b.size) <= b.maxSize {
+		return false
+	}
+	victim := b.victim()
+	if victim == m {
+		return true
+	}
+	if victim != nil {
+		select {
+		case victim.control <- controlBudgetGC{}:
+		default:
+		}
+	}
+	return false
+}
+
+// How much a member should prune: enough to get the budget back under its max
+// size, plus percentToPrune of the member's size, without going below the
+// member's minimum.
+func (m *budgetMember) sizeToPrune(size int64, percentToPrune int) int64 {
+	b := m.budget
+	sizeToPrune := atomic.LoadInt64(&b.size) - b.maxSize
+	if sizeToPrune <= 0 {
+		return 0
+	}
+	sizeToPrune += size * int64(percentToPrune) / 100
+	if available := size - m.minSize; sizeToPrune > available {
+		return available
+	}
+	return sizeToPrune
+}
@@ -0,0 +1,98 @@
+package ccache
+
+import (
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/karlseguin/ccache/v3/assert"
+)
+
+func Test_Budget_PrunesTheCacheMostOverItsShare(t *testing.T) {
+	budget := NewBudget(100)
+	a := New(Configure[int]().PercentToPrune(0).Budget(budget, 1, 0))
+	defer a.Stop()
+	b := Layered(Configure[int]().PercentToPrune(0).Budget(budget, 1, 0))
+	defer b.Stop()
+
+	for i := 0; i < 100; i++ {
+		a.Set(strconv.Itoa(i), i, time.Minute)
+	}
+	a.SyncUpdates()
+	assert.Equal(t, budget.Size(), 100)
+
+	for i := 0; i < 20; i++ {
+		b.Set("p", strconv.Itoa(i), i, time.Minute)
+	}
+	b.SyncUpdates()
+	a.SyncUpdates()
+
+	assert.Equal(t, a.GetSize(), 80)
+	assert.Equal(t, b.GetSize(), 20)
+	assert.Equal(t, budget.Size(), 100)
+	assert.Equal(t, a.Get("19"), nil)
+	assert.Equal(t, a.Get("20").Value(), 20)
+	assert.Equal(t, a.GetDropped(), 20)
+}
+
+func Test_Budget_HonorsWeights(t *testing.T) {
+	budget := NewBudget(100)
+	a := New(Configure[int]().PercentToPrune(0).Budget(budget, 3, 0))
+	defer a.Stop()
+	b := New(Configure[int]().PercentToPrune(0).Budget(budget, 1, 0))
+	defer b.Stop()
+
+	for i := 0; i < 60; i++ {
+		a.Set(strconv.Itoa(i), i, time.Minute)
+		b.Set(strconv.Itoa(i), i, time.Minute)
+	}
+	a.SyncUpdates()
+	b.SyncUpdates()
+	a.SyncUpdates()
+
+	// b's share is 25, a's is 75, so b is pruned even though
+	// they're the same size
+	assert.Equal(t, a.GetSize(), 60)
+	assert.Equal(t, b.GetSize(), 40)
+}
+
+func Test_Budget_GuaranteesMinimums(t *testing.T) {
+	budget := NewBudget(100)
+	a := New(Configure[int]().PercentToPrune(0).Budget(budget, 1, 90))
+	defer a.Stop()
+	b := New(Configure[int]().PercentToPrune(0).Budget(budget, 1, 0))
+	defer b.Stop()
+
+	for i := 0; i < 100; i++ {
+		a.Set(strconv.Itoa(i), i, time.Minute)
+	}
+	a.SyncUpdates()
+
+	for i := 0; i < 30; i++ {
+		b.Set(strconv.Itoa(i), i, time.Minute)
+		b.SyncUpdates()
+		a.SyncUpdates()
+	}
+	assert.Equal(t, a.GetSize(), 90)
+	assert.Equal(t, b.GetSize(), 10)
+	assert.Equal(t, b.Get("19"), nil)
+	assert.Equal(t, b.Get("20").Value(), 20)
+}
+
+func Test_Budget_StoppedCachesLeaveTheBudget(t *testing.T) {
+	budget := NewBudget(100)
+	a := New(Configure[int]().Budget(budget, 1, 0))
+	b := New(Configure[int]().Budget(budget, 1, 0))
+	defer b.Stop()
+
+	a.Set("a", 1, time.Minute)
+	b.Set("b", 1, time.Minute)
+	a.SyncUpdates()
+	b.SyncUpdates()
+	assert.Equal(t, budget.Size(), 2)
+
+	a.Stop()
+	<-a.stopped
+	assert.Equal(t, budget.Size(), 1)
+	assert.Equal(t, len(budget.members), 1)
+}
@@ -3,6 +3,9 @@ package ccache
 
 import (
 	"hash/fnv"
+	"iter"
+	"sort"
+	"strings"
 	"sync/atomic"
 	"time"
 )
@@ -10,34 +13,63 @@ import (
 type Cache[T any] struct {
 	*Configuration[T]
 	control
-	list            *List[T]
-	size            int64
-	pruneTargetSize int64
-	buckets         []*bucket[T]
-	bucketMask      uint32
-	deletables      chan *Item[T]
-	promotables     chan *Item[T]
+	cacheWorker[T]
+	buckets      []*bucket[T]
+	bucketMask   uint32
+	tags         *tagIndex[T]
+	dependencies *dependencyGraph[T]
+	keys         *keyIndex[T]
+	indexes      map[string]*valueIndex[T]
+	pinnedSize   int64
+	missRatio    *missRatio
+	hotKeys      *hotKeys
+
+	// dependents which the worker has removed from their bucket but has yet
+	// to delete. Only the worker touches this.
+	invalidated []*Item[T]
 }
 
 // Create a new cache with the specified configuration
 // See ccache.Configure() for creating a configuration
 func New[T any](config *Configuration[T]) *Cache[T] {
 	c := &Cache[T]{
-		list:            NewList[T](),
-		Configuration:   config,
-		control:         newControl(),
-		bucketMask:      uint32(config.buckets) - 1,
-		buckets:         make([]*bucket[T], config.buckets),
-		deletables:      make(chan *Item[T], config.deleteBuffer),
-		promotables:     make(chan *Item[T], config.promoteBuffer),
-		pruneTargetSize: config.maxSize - config.maxSize*int64(config.percentToPrune)/100,
+		Configuration: config,
+		control:       newControl(),
+		bucketMask:    uint32(config.buckets) - 1,
+		buckets:       make([]*bucket[T], config.buckets),
+		tags:          newTagIndex[T](),
+		dependencies:  newDependencyGraph[T](),
+	}
+	c.cacheWorker = newCacheWorker[T](c, config, c.control, config.newPolicy)
+	if config.hotKeys > 0 {
+		c.hotKeys = newHotKeys(config.hotKeys, config.hotKeysWindow)
+	}
+	if config.mrcRate > 0 || config.mrcGhosts > 0 {
+		c.missRatio = newMissRatio(config.mrcGhosts, config.mrcRate)
+		c.collected = func(item *Item[T]) {
+			c.missRatio.evict(item.key, item.size)
+		}
+	}
+	observers := []bucketObserver[T]{c.tags}
+	if config.prefixIndex {
+		c.keys = newKeyIndex[T]()
+		observers = append(observers, c.keys)
+	}
+	if len(config.indexes) > 0 {
+		c.indexes = make(map[string]*valueIndex[T], len(config.indexes))
+		for name, extract := range config.indexes {
+			index := newValueIndex(extract)
+			c.indexes[name] = index
+			observers = append(observers, index)
+		}
 	}
 	for i := 0; i < config.buckets; i++ {
 		c.buckets[i] = &bucket[T]{
-			lookup: make(map[string]*Item[T]),
+			lookup:    make(map[string]*Item[T]),
+			observers: observers,
 		}
 	}
-	go c.worker()
+	c.start()
 	return c
 }
 
@@ -50,6 +82,9 @@ func (c *Cache[T]) ItemCount() int {
 }
 
 func (c *Cache[T]) DeletePrefix(prefix string) int {
+	if c.keys != nil {
+		return c.deleteItems(c.keys.prefixed(prefix))
+	}
 	count := 0
 	for _, b := range c.buckets {
 		count += b.deletePrefix(prefix, c.deletables)
@@ -57,6 +92,44 @@ func (c *Cache[T]) DeletePrefix(prefix string) int {
 	return count
 }
 
+// Calls fn for every item whose key starts with prefix, until fn returns
+// false. With the PrefixIndex() option, items are visited in key order and
+// the cost is proportional to the number of matching keys. Otherwise, every
+// key is checked, and the order is random.
+func (c *Cache[T]) ScanPrefix(prefix string, fn func(key string, item *Item[T]) bool) {
+	if c.keys == nil {
+		c.ForEachFunc(func(key string, item *Item[T]) bool {
+			if strings.HasPrefix(key, prefix) {
+				return fn(key, item)
+			}
+			return true
+		})
+		return
+	}
+	// fn is called without holding any lock, so it's free to use the cache
+	for _, item := range c.keys.prefixed(prefix) {
+		if !fn(item.key, item) {
+			return
+		}
+	}
+}
+
+// The number of items whose key starts with prefix. With the PrefixIndex()
+// option, this costs the length of the prefix. Otherwise, every key is checked.
+func (c *Cache[T]) CountPrefix(prefix string) int {
+	if c.keys != nil {
+		return c.keys.countPrefix(prefix)
+	}
+	count := 0
+	c.ForEachFunc(func(key string, item *Item[T]) bool {
+		if strings.HasPrefix(key, prefix) {
+			count += 1
+		}
+		return true
+	})
+	return count
+}
+
 // Deletes all items that the matches func evaluates to true.
 func (c *Cache[T]) DeleteFunc(matches func(key string, item *Item[T]) bool) int {
 	count := 0
@@ -74,20 +147,139 @@ func (c *Cache[T]) ForEachFunc(matches func(key string, item *Item[T]) bool) {
 	}
 }
 
+// Iterates over every item in the cache, in random order. Buckets are visited
+// one at a time: each is copied while holding its read lock, which is released
+// before any of its items are yielded, so the loop's body is free to use the
+// cache. Items set or deleted during the iteration may or may not be seen.
+func (c *Cache[T]) All() iter.Seq2[string, *Item[T]] {
+	return func(yield func(string, *Item[T]) bool) {
+		for _, b := range c.buckets {
+			for _, item := range b.items() {
+				if !yield(item.key, item) {
+					return
+				}
+			}
+		}
+	}
+}
+
+// The keys of every item in the cache. Same semantics as All.
+func (c *Cache[T]) Keys() iter.Seq[string] {
+	return func(yield func(string) bool) {
+		for key := range c.All() {
+			if !yield(key) {
+				return
+			}
+		}
+	}
+}
+
+// The values of every item in the cache. Same semantics as All.
+func (c *Cache[T]) Values() iter.Seq[T] {
+	return func(yield func(T) bool) {
+		for _, item := range c.All() {
+			if !yield(item.value) {
+				return
+			}
+		}
+	}
+}
+
+// Iterates over every item, from the most to the least recently used (items of
+// a higher priority come first, see SetWithPriority). When iteration starts,
+// the worker copies its list, which costs O(n) of the worker's time (holding
+// up promotions and deletions) and memory. The order is the one the worker
+// knew of, so recent Gets it has yet to process aren't reflected. No lock is
+// held while yielding. Items deleted or replaced since the copy was made are
+// skipped, items added since aren't seen.
+func (c *Cache[T]) ByRecency() iter.Seq2[string, *Item[T]] {
+	return func(yield func(string, *Item[T]) bool) {
+		for _, item := range c.recencySnapshot() {
+			if c.bucket(item.key).get(item.key) != item {
+				continue
+			}
+			if !yield(item.key, item) {
+				return
+			}
+		}
+	}
+}
+
+func (c *Cache[T]) recencySnapshot() []*Item[T] {
+	res := make(chan []*Item[T], 1)
+	c.control <- controlRecency{res: res}
+	return <-res
+}
+
+// Calls fn, in key order, for every item whose key is >= start and < end, until
+// fn returns false. An empty end means there's no upper bound. With the
+// PrefixIndex() option, the cost is proportional to the number of items in the
+// range. Otherwise, every key is checked and the matching ones are sorted.
+func (c *Cache[T]) Range(start string, end string, fn func(key string, item *Item[T]) bool) {
+	// fn is called without holding any lock, so it's free to use the cache
+	for _, item := range c.between(start, end, 0) {
+		if !fn(item.key, item) {
+			return
+		}
+	}
+}
+
+// Returns up to limit items, in key order, starting at cursor, along with the
+// cursor to pass to the next call. Start a scan with an empty cursor, it's
+// complete when the returned cursor is empty. A key which is in the cache for
+// the entire duration of a scan is always returned. A key which is set or
+// deleted during the scan may, or may not, be. Like Range, this is only
+// efficient with the PrefixIndex() option.
+func (c *Cache[T]) Scan(cursor string, limit int) ([]*Item[T], string) {
+	if limit <= 0 {
+		limit = 1
+	}
+	items := c.between(cursor, "", limit)
+	if len(items) < limit {
+		return items, ""
+	}
+	// the smallest key greater than the last one we're returning
+	return items, items[len(items)-1].key + "\x00"
+}
+
+func (c *Cache[T]) between(from string, to string, limit int) []*Item[T] {
+	if c.keys != nil {
+		return c.keys.between(from, to, limit)
+	}
+	var items []*Item[T]
+	c.ForEachFunc(func(key string, item *Item[T]) bool {
+		if key >= from && (to == "" || key < to) {
+			items = append(items, item)
+		}
+		return true
+	})
+	sort.Slice(items, func(i, j int) bool {
+		return items[i].key < items[j].key
+	})
+	if limit > 0 && len(items) > limit {
+		items = items[:limit]
+	}
+	return items
+}
+
 // Get an item from the cache. Returns nil if the item wasn't found.
 // This can return an expired item. Use item.Expired() to see if the item
 // is expired and item.TTL() to see how long until the item expires (which
 // will be negative for an already expired item).
 func (c *Cache[T]) Get(key string) *Item[T] {
 	item := c.bucket(key).get(key)
+	if c.missRatio != nil {
+		if item == nil {
+			c.missRatio.get(key, 0, false)
+		} else {
+			c.missRatio.get(key, item.size, true)
+		}
+	}
 	if item == nil {
 		return nil
 	}
 	if !item.Expired() {
-		select {
-		case c.promotables <- item:
-		default:
-		}
+		c.touch(item)
 	}
 	return item
 }
@@ -121,6 +313,131 @@ func (c *Cache[T]) Set(key string, value T, duration time.Duration) {
 	c.set(key, value, duration, false)
 }
 
+// Like Set, but returns false if the item was rejected by the cache's
+// admission policy (see Configuration.Admit), in which case it wasn't stored.
+func (c *Cache[T]) TrySet(key string, value T, duration time.Duration) bool {
+	return c.add(newItem(key, value, time.Now().Add(duration).UnixNano(), false))
+}
+
+// Set the value in the cache for the specified duration, tagged with the
+// given tags. Every item with a tag can be removed with DeleteByTag.
+func (c *Cache[T]) SetWithTags(key string, value T, duration time.Duration, tags ...string) {
+	if len(tags) > 0 {
+		tags = append([]string(nil), tags...)
+	}
+	c.setWithTags(key, value, duration, false, tags)
+}
+
+// Set the value in the cache for the specified duration, as depending on the
+// given keys. When any of those keys is deleted, replaced or evicted, the item
+// is deleted too (as are the items which depend on it, and so on).
+func (c *Cache[T]) SetWithDependencies(key string, value T, duration time.Duration, dependencies ...string) {
+	item := newItem(key, value, time.Now().Add(duration).UnixNano(), false)
+	if len(dependencies) > 0 {
+		item.extend().dependencies = append([]string(nil), dependencies...)
+	}
+	c.add(item)
+}
+
+// Set the value in the cache for the specified duration, with the given
+// priority. When the cache is full, items with a lower priority are evicted
+// first (items set without a priority have PriorityNormal).
+func (c *Cache[T]) SetWithPriority(key string, value T, duration time.Duration, priority Priority) {
+	if priority < PriorityLow {
+		priority = PriorityLow
+	} else if priority > PriorityHigh {
+		priority = PriorityHigh
+	}
+	item := newItem(key, value, time.Now().Add(duration).UnixNano(), false)
+	item.priority = priority
+	c.add(item)
+}
+
+// Set the value in the cache for the specified duration, along with how long
+// the value takes to recompute. The cost is only used by the CostAware()
+// eviction policy, which prefers to evict items with a low cost per unit of
+// size.
+func (c *Cache[T]) SetWithCost(key string, value T, duration time.Duration, cost time.Duration) {
+	item := newItem(key, value, time.Now().Add(duration).UnixNano(), false)
+	if cost != 0 {
+		item.extend().cost = int64(cost)
+	}
+	c.add(item)
+}
+
+// Set the value in the cache for the specified duration, and pin it. Returns
+// false if the item couldn't be pinned because it would put the total size of
+// pinned items over MaxPinnedSize (the item is still set, but isn't pinned),
+// or if the item was rejected by the cache's admission policy.
+func (c *Cache[T]) SetPinned(key string, value T, duration time.Duration) bool {
+	item := newItem(key, value, time.Now().Add(duration).UnixNano(), false)
+	if !c.add(item) {
+		return false
+	}
+	return c.pin(item, nil, true)
+}
+
+// Pins the item, which exempts it from being evicted by the cache (when the
+// cache is full, or via EvictOldest, ShrinkTo or PurgeExpired). A pinned item
+// is still removed by Delete (and the likes of DeletePrefix or Clear), and by
+// being replaced with Set. Replace keeps the item pinned. Returns false if
+// there's no item for the key, or if pinning it would put the total size of
+// pinned items over MaxPinnedSize.
+func (c *Cache[T]) Pin(key string) bool {
+	item := c.bucket(key).get(key)
+	if item == nil {
+		return false
+	}
+	return c.pin(item, nil, true)
+}
+
+// Unpins the item, making it evictable again. Returns false if there's no
+// item for the key, or if it wasn't pinned.
+func (c *Cache[T]) Unpin(key string) bool {
+	item := c.bucket(key).get(key)
+	if item == nil {
+		return false
+	}
+	return c.pin(item, nil, false)
+}
+
+// The total size of pinned items
+func (c *Cache[T]) PinnedSize() int64 {
+	return atomic.LoadInt64(&c.pinnedSize)
+}
+
+// Estimates the cache's hit ratio at a few sizes, from a quarter of its max
+// size to 8 times it. Returns nil unless the cache was configured with
+// TrackMissRatio.
+// This is a control command.
+func (c *Cache[T]) MissRatioCurve() []MissRatioPoint {
+	if c.missRatio == nil {
+		return nil
+	}
+	res := make(chan []MissRatioPoint)
+	c.control <- controlMissRatioCurve{res: res}
+	return <-res
+}
+
+// The (up to) n most accessed keys, most accessed first. Returns nil unless
+// the cache was configured with TrackHotKeys.
+// This is a control command.
+func (c *Cache[T]) TopKeys(n int) []HotKey {
+	if c.hotKeys == nil {
+		return nil
+	}
+	res := make(chan []HotKey)
+	c.control <- controlTopKeys{n: n, res: res}
+	return <-res
+}
+
+// previous, if not nil, is an item whose pin is transferred to item
+func (c *Cache[T]) pin(item *Item[T], previous *Item[T], pin bool) bool {
+	res := make(chan bool, 1)
+	c.control <- controlPin{item: item, previous: previous, pin: pin, res: res}
+	return <-res
+}
+
 // Setnx set the value in the cache for the specified duration if not exists
 func (c *Cache[T]) Setnx(key string, value T, duration time.Duration) {
 	c.bucket(key).setnx(key, value, duration, false)
@@ -131,10 +448,7 @@ func (c *Cache[T]) Setnx2(key string, f func() T, duration time.Duration) *Item[
 	item, existing := c.bucket(key).setnx2(key, f, duration, false)
 	// consistent with Get
 	if existing && !item.Expired() {
-		select {
-		case c.promotables <- item:
-		default:
-		}
+		c.touch(item)
 		// consistent with set
 	} else if !existing {
 		c.promotables <- item
@@ -150,7 +464,17 @@ func (c *Cache[T]) Replace(key string, value T) bool {
 	if item == nil {
 		return false
 	}
-	c.Set(key, value, item.TTL())
+	replacement := newItem(key, value, atomic.LoadInt64(&item.expires), false)
+	replacement.priority = item.priority
+	if item.ext != nil {
+		// the tags, dependencies and cost
+		ext := *item.ext
+		replacement.ext = &ext
+	}
+	c.insert(replacement)
+	if item.Pinned() {
+		c.pin(replacement, item, true)
+	}
 	return true
 }
 
@@ -168,7 +492,8 @@ func (c *Cache[T]) Extend(key string, duration time.Duration) bool {
 
 // Attempts to get the value from the cache and calles fetch on a miss (missing
 // or stale item). If fetch returns an error, no value is cached and the error
-// is returned back to the caller.
+// is returned back to the caller. How long fetch took is recorded as the item's
+// cost (see SetWithCost).
 // Note that Fetch merely calls the public Get and Set functions. If you want
 // a different Fetch behavior, such as thundering herd protection or returning
 // expired items, implement it in your application.
@@ -177,11 +502,15 @@ func (c *Cache[T]) Fetch(key string, duration time.Duration, fetch func() (T, er
 	if item != nil && !item.Expired() {
 		return item, nil
 	}
+	start := time.Now()
 	value, err := fetch()
 	if err != nil {
 		return nil, err
 	}
-	return c.set(key, value, duration, false), nil
+	item = newItem(key, value, time.Now().Add(duration).UnixNano(), false)
+	item.extend().cost = int64(time.Since(start))
+	c.add(item)
+	return item, nil
 }
 
 // Remove the item from the cache, return true if the item was present, false otherwise.
@@ -194,8 +523,87 @@ func (c *Cache[T]) Delete(key string) bool {
 	return false
 }
 
+// Deletes every item tagged with tag. Returns the number of items deleted.
+func (c *Cache[T]) DeleteByTag(tag string) int {
+	return c.deleteItems(c.tags.items(tag))
+}
+
+// Gets the items indexed under value by the named index (see
+// Configuration.Index). Returns nil if there are none, or if there's no such
+// index. Like Get, this can return expired items, and it promotes the items it
+// returns.
+func (c *Cache[T]) GetByIndex(name string, value string) []*Item[T] {
+	index := c.indexes[name]
+	if index == nil {
+		return nil
+	}
+	items := index.items(value)
+	for _, item := range items {
+		if !item.Expired() {
+			c.touch(item)
+		}
+	}
+	return items
+}
+
+// Deletes every item indexed under value by the named index. Returns the number
+// of items deleted.
+func (c *Cache[T]) DeleteByIndex(name string, value string) int {
+	index := c.indexes[name]
+	if index == nil {
+		return 0
+	}
+	return c.deleteItems(index.items(value))
+}
+
+// Deletes the items (taken from one of our indexes). Returns the number of
+// items deleted.
+func (c *Cache[T]) deleteItems(items []*Item[T]) int {
+	count := 0
+	for _, item := range items {
+		// the item might have been replaced or removed since we got it
+		if c.bucket(item.key).removeItem(item) {
+			c.deletables <- item
+			count += 1
+		}
+	}
+	return count
+}
+
 func (c *Cache[T]) set(key string, value T, duration time.Duration, track bool) *Item[T] {
-	item, existing := c.bucket(key).set(key, value, duration, track)
+	return c.setWithTags(key, value, duration, track, nil)
+}
+
+// Returns the item even if it was rejected by the admission policy
+func (c *Cache[T]) setWithTags(key string, value T, duration time.Duration, track bool, tags []string) *Item[T] {
+	item := newItem(key, value, time.Now().Add(duration).UnixNano(), track)
+	if len(tags) > 0 {
+		item.extend().tags = tags
+	}
+	c.add(item)
+	return item
+}
+
+// Inserts the item, unless it's rejected by the admission policy. Returns
+// false if it was rejected. Updates of a key which is already in the cache are
+// always admitted: rejecting them would leave the old value in place.
+func (c *Cache[T]) add(item *Item[T]) bool {
+	if admit := c.admit; admit != nil && c.bucket(item.key).get(item.key) == nil {
+		if !admit(item.key, item.value, item.size) {
+			return false
+		}
+	}
+	c.insert(item)
+	return true
+}
+
+func (c *Cache[T]) insert(item *Item[T]) *Item[T] {
+	if len(item.dependencies()) > 0 {
+		// before the item is visible, so that a concurrent delete of one of
+		// its dependencies can't be missed
+		c.dependencies.add(item)
+	}
+	existing := c.bucket(item.key).setItem(item)
 	if existing != nil {
 		c.deletables <- existing
 	}
@@ -203,6 +611,20 @@ func (c *Cache[T]) set(key string, value T, duration time.Duration, track bool)
 	return item
 }
 
+// Records a get of the item. With SIEVE or CLOCK, that's only setting the
+// item's visited bit. Otherwise, the item is sent to the worker to be promoted
+// (unless the worker is too busy).
+func (c *Cache[T]) touch(item *Item[T]) {
+	if c.visitedBit {
+		item.visit()
+		return
+	}
+	select {
+	case c.promotables <- item:
+	default:
+	}
+}
+
 func (c *Cache[T]) bucket(key string) *bucket[T] {
 	h := fnv.New32a()
 	h.Write([]byte(key))
@@ -227,78 +649,52 @@ func (c *Cache[T]) unhalt() {
 	}
 }
 
-func (c *Cache[T]) worker() {
-	dropped := 0
-	cc := c.control
-
-	promoteItem := func(item *Item[T]) {
-		if c.doPromote(item) && c.size > c.maxSize {
-			dropped += c.gc()
-		}
-	}
+// Handles the control messages which are specific to the Cache. Only the
+// worker should call this
+func (c *Cache[T]) handle(msg interface{}) {
+	switch msg := msg.(type) {
+	case controlClear:
+		c.halted(func() {
+			promotables := c.promotables
+			for len(promotables) > 0 {
+				<-promotables
+			}
+			deletables := c.deletables
+			for len(deletables) > 0 {
+				<-deletables
+			}
 
-	for {
-		select {
-		case item := <-c.promotables:
-			promoteItem(item)
-		case item := <-c.deletables:
-			c.doDelete(item)
-		case control := <-cc:
-			switch msg := control.(type) {
-			case controlStop:
-				goto drain
-			case controlGetDropped:
-				msg.res <- dropped
-				dropped = 0
-			case controlSetMaxSize:
-				newMaxSize := msg.size
-				c.maxSize = newMaxSize
-				c.pruneTargetSize = newMaxSize - newMaxSize*int64(c.percentToPrune)/100
-				if c.size > c.maxSize {
-					dropped += c.gc()
-				}
-				msg.done <- struct{}{}
-			case controlClear:
-				c.halted(func() {
-					promotables := c.promotables
-					for len(promotables) > 0 {
-						<-promotables
-					}
-					deletables := c.deletables
-					for len(deletables) > 0 {
-						<-deletables
-					}
-
-					for _, bucket := range c.buckets {
-						bucket.clear()
-					}
-					c.size = 0
-					c.list = NewList[T]()
-				})
-				msg.done <- struct{}{}
-			case controlGetSize:
-				msg.res <- c.size
-			case controlGC:
-				dropped += c.gc()
-				msg.done <- struct{}{}
-			case controlSyncUpdates:
-				doAllPendingPromotesAndDeletes(c.promotables, promoteItem, c.deletables, c.doDelete)
-				msg.done <- struct{}{}
+			for _, bucket := range c.buckets {
+				bucket.clear()
 			}
+			c.reset()
+			c.dependencies = newDependencyGraph[T]()
+			atomic.StoreInt64(&c.pinnedSize, 0)
+			c.invalidated = nil
+		})
+		msg.done <- struct{}{}
+	case controlTopKeys:
+		msg.res <- c.hotKeys.top(msg.n)
+	case controlMissRatioCurve:
+		msg.res <- c.missRatio.curve(c.maxSize)
+	case controlPin:
+		item := msg.item.(*Item[T])
+		if previous := msg.previous.(*Item[T]); previous != nil {
+			c.doUnpin(previous)
 		}
-	}
-
-drain:
-	for {
-		select {
-		case item := <-c.deletables:
-			c.doDelete(item)
-		default:
-			return
+		if msg.pin {
+			msg.res <- c.doPin(item)
+		} else {
+			msg.res <- c.doUnpin(item)
 		}
 	}
 }
 
+// Only the worker should call this
+func (c *Cache[T]) processed() {
+	c.deleteInvalidated()
+}
+
 // This method is used to implement SyncUpdates. It simply receives and processes as many
 // items as it can receive from the promotables and deletables channels immediately without
 // blocking. If some other goroutine sends an item on either channel after this method has
@@ -331,64 +727,101 @@ doAllDeletes:
 }
 
 func (c *Cache[T]) doDelete(item *Item[T]) {
+	c.invalidateDependents(item)
+	c.doUnpin(item)
 	if !item.inList {
 		item.promotions = -2
 	} else {
-		c.size -= item.size
+		c.untrack(item)
 		if c.onDelete != nil {
 			c.onDelete(item)
 		}
-		c.list.Remove(item)
 		item.promotions = -2
 	}
 }
 
 func (c *Cache[T]) doPromote(item *Item[T]) bool {
-	// already deleted
-	if item.promotions == -2 {
-		return false
+	if c.hotKeys != nil {
+		c.hotKeys.record(item.group, item.key)
 	}
+	added, _ := c.track(item)
+	return added
+}
 
-	if item.inList {
-		if item.shouldPromote(c.getsPerPromote) {
-			c.list.MoveToFront(item)
-			item.promotions = 0
-		}
+// pinned items, and tracked items that haven't been released, can't be evicted
+func (c *Cache[T]) evictable(item *Item[T]) bool {
+	if item.Pinned() {
 		return false
 	}
+	return !c.tracking || atomic.LoadInt32(&item.refCount) == 0
+}
 
-	c.size += item.size
-	c.list.Insert(item)
+// Only the worker should call this
+func (c *Cache[T]) doPin(item *Item[T]) bool {
+	if item.promotions == -2 {
+		// already deleted
+		return false
+	}
+	if item.Pinned() {
+		return true
+	}
+	maxPinnedSize := c.maxPinnedSize
+	if maxPinnedSize == 0 {
+		maxPinnedSize = c.maxSize / 2
+	}
+	if c.pinnedSize+item.size > maxPinnedSize {
+		return false
+	}
+	item.setPinned(true)
+	atomic.AddInt64(&c.pinnedSize, item.size)
 	return true
 }
 
-func (c *Cache[T]) gc() int {
-	dropped := 0
-	item := c.list.Tail
+// Only the worker should call this
+func (c *Cache[T]) doUnpin(item *Item[T]) bool {
+	if !item.Pinned() {
+		return false
+	}
+	item.setPinned(false)
+	atomic.AddInt64(&c.pinnedSize, -item.size)
+	return true
+}
 
-	prunedSize := int64(0)
-	sizeToPrune := c.size - c.pruneTargetSize
+// removes the item from the lookup and the list. Only the worker should call this
+func (c *Cache[T]) evict(item *Item[T]) {
+	// the key might already hold a newer item (whose replacement of this one we
+	// haven't processed yet), which must be left alone
+	c.bucket(item.key).removeItem(item)
+	c.untrack(item)
+	if c.onDelete != nil {
+		c.onDelete(item)
+	}
+	item.promotions = -2
+	c.invalidateDependents(item)
+}
 
-	for prunedSize < sizeToPrune {
-		if item == nil {
-			return dropped
+// Called by the worker when an item is removed. Drops the item's own
+// dependency edges, and removes the items which depend on its key from their
+// buckets. Those are only deleted from the list (and, in turn, invalidate their
+// own dependents) by deleteInvalidated, so that callers iterating over the list
+// (like gc) aren't affected. An item is only ever taken from the graph and
+// removed from its bucket once, which is what keeps cycles from looping.
+func (c *Cache[T]) invalidateDependents(item *Item[T]) {
+	c.dependencies.remove(item)
+	for _, dependent := range c.dependencies.take(item.key) {
+		if c.bucket(dependent.key).removeItem(dependent) {
+			c.invalidated = append(c.invalidated, dependent)
 		}
-		// fmt.Println(item.key)
-		prev := item.prev
-		if !c.tracking || atomic.LoadInt32(&item.refCount) == 0 {
-			c.bucket(item.key).delete(item.key)
-			itemSize := item.size
-			c.size -= itemSize
-			prunedSize += itemSize
-
-			c.list.Remove(item)
-			if c.onDelete != nil {
-				c.onDelete(item)
-			}
-			dropped += 1
-			item.promotions = -2
-		}
-		item = prev
 	}
-	return dropped
+}
+
+// Only the worker should call this
+func (c *Cache[T]) deleteInvalidated() {
+	for len(c.invalidated) > 0 {
+		l := len(c.invalidated) - 1
+		item := c.invalidated[l]
+		c.invalidated[l] = nil
+		c.invalidated = c.invalidated[:l]
+		c.doDelete(item)
+	}
 }
@@ -1,6 +1,7 @@
 package ccache
 
 import (
+	"fmt"
 	"math/rand"
 	"sort"
 	"strconv"
@@ -462,6 +463,751 @@ func Test_CachePrune(t *testing.T) {
 	}
 }
 
+func Test_CacheEvictOldest(t *testing.T) {
+	deleted := int32(0)
+	cache := New(Configure[int]().OnDelete(func(item *Item[int]) {
+		atomic.AddInt32(&deleted, 1)
+	}))
+	defer cache.Stop()
+
+	for i := 0; i < 10; i++ {
+		cache.Set(strconv.Itoa(i), i, time.Minute)
+	}
+	cache.SyncUpdates()
+	assert.Equal(t, cache.EvictOldest(3), 3)
+	assert.Equal(t, cache.Get("2"), nil)
+	assert.Equal(t, cache.Get("3").Value(), 3)
+	assert.Equal(t, cache.GetSize(), 7)
+	assert.Equal(t, atomic.LoadInt32(&deleted), 3)
+
+	assert.Equal(t, cache.EvictOldest(100), 7)
+	assert.Equal(t, cache.ItemCount(), 0)
+	assert.Equal(t, cache.GetDropped(), 0)
+}
+
+func Test_CacheShrinkTo(t *testing.T) {
+	cache := New(Configure[*SizedItem]())
+	defer cache.Stop()
+
+	for i := 0; i < 10; i++ {
+		cache.Set(strconv.Itoa(i), &SizedItem{i, 2}, time.Minute)
+	}
+	cache.SyncUpdates()
+	assert.Equal(t, cache.ShrinkTo(15), 3)
+	assert.Equal(t, cache.GetSize(), 14)
+	assert.Equal(t, cache.Get("2"), nil)
+	assert.Equal(t, cache.Get("3").Value().id, 3)
+
+	assert.Equal(t, cache.ShrinkTo(20), 0)
+	assert.Equal(t, cache.GetSize(), 14)
+}
+
+func Test_CachePurgeExpired(t *testing.T) {
+	deleted := int32(0)
+	cache := New(Configure[int]().OnDelete(func(item *Item[int]) {
+		atomic.AddInt32(&deleted, 1)
+	}))
+	defer cache.Stop()
+
+	cache.Set("a", 1, time.Minute)
+	cache.Set("b", 2, -time.Minute)
+	cache.Set("c", 3, time.Minute)
+	cache.Set("d", 4, -time.Second)
+	cache.SyncUpdates()
+
+	assert.Equal(t, cache.PurgeExpired(), 2)
+	assert.Equal(t, cache.Get("b"), nil)
+	assert.Equal(t, cache.Get("d"), nil)
+	assert.Equal(t, cache.Get("a").Value(), 1)
+	assert.Equal(t, cache.Get("c").Value(), 3)
+	assert.Equal(t, cache.GetSize(), 2)
+	assert.Equal(t, atomic.LoadInt32(&deleted), 2)
+	assert.Equal(t, cache.PurgeExpired(), 0)
+}
+
+func Test_CacheDoesntCountManualEvictionsAsDropped(t *testing.T) {
+	cache := New(Configure[int]().MaxSize(10).PercentToPrune(10))
+	defer cache.Stop()
+
+	for i := 0; i < 11; i++ {
+		cache.Set(strconv.Itoa(i), i, time.Minute)
+		cache.SyncUpdates()
+	}
+	cache.Set("expired", 0, -time.Minute)
+	cache.SyncUpdates()
+	assert.Equal(t, cache.EvictOldest(2), 2)
+	assert.Equal(t, cache.ShrinkTo(5), 3)
+	assert.Equal(t, cache.PurgeExpired(), 1)
+	assert.Equal(t, cache.GetSize(), 4)
+	assert.Equal(t, cache.GetDropped(), 2)
+	assert.Equal(t, cache.GetDropped(), 0)
+}
+
+func Test_CachePrunesExpiredItemsFirst(t *testing.T) {
+	cache := New(Configure[int]().MaxSize(10).PercentToPrune(20).PruneExpiredFirst())
+	defer cache.Stop()
+
+	for i := 0; i < 10; i++ {
+		ttl := time.Minute
+		if i == 5 || i == 7 {
+			ttl = -time.Minute
+		}
+		cache.Set(strconv.Itoa(i), i, ttl)
+	}
+	cache.SyncUpdates()
+	cache.Set("10", 10, time.Minute)
+	cache.SyncUpdates()
+
+	// the 3 pruned items should be the 2 expired ones, and then the oldest one
+	assert.Equal(t, cache.GetDropped(), 3)
+	assert.Equal(t, cache.Get("5"), nil)
+	assert.Equal(t, cache.Get("7"), nil)
+	assert.Equal(t, cache.Get("0"), nil)
+	assert.Equal(t, cache.Get("1").Value(), 1)
+	assert.Equal(t, cache.Get("10").Value(), 10)
+	assert.Equal(t, cache.GetSize(), 8)
+}
+
+func Test_CachePrunesExpiredItemsFirstSkipsTrackedItems(t *testing.T) {
+	cache := New(Configure[int]().MaxSize(5).PercentToPrune(20).PruneExpiredFirst().Track())
+	defer cache.Stop()
+
+	item := cache.TrackingSet("0", 0, -time.Minute)
+	for i := 1; i < 5; i++ {
+		cache.Set(strconv.Itoa(i), i, time.Minute)
+	}
+	cache.SyncUpdates()
+	cache.Set("5", 5, time.Minute)
+	cache.SyncUpdates()
+	assert.Equal(t, cache.Get("0").Value(), 0)
+	assert.Equal(t, cache.Get("1"), nil)
+
+	item.Release()
+	assert.Equal(t, cache.PurgeExpired(), 1)
+	assert.Equal(t, cache.Get("0"), nil)
+}
+
+func Test_CacheDeleteByTag(t *testing.T) {
+	cache := New(Configure[int]())
+	defer cache.Stop()
+
+	cache.SetWithTags("a", 1, time.Minute, "user:1", "org:1")
+	cache.SetWithTags("b", 2, time.Minute, "user:2", "org:1")
+	cache.SetWithTags("c", 3, time.Minute, "user:1")
+	cache.Set("d", 4, time.Minute)
+	assert.List(t, cache.Get("a").Tags(), []string{"user:1", "org:1"})
+
+	assert.Equal(t, cache.DeleteByTag("user:1"), 2)
+	assert.Equal(t, cache.Get("a"), nil)
+	assert.Equal(t, cache.Get("c"), nil)
+	assert.Equal(t, cache.Get("b").Value(), 2)
+	assert.Equal(t, cache.Get("d").Value(), 4)
+
+	// "a" is gone, so only "b" is left under org:1
+	assert.Equal(t, len(cache.tags.items("org:1")), 1)
+	assert.Equal(t, cache.DeleteByTag("org:1"), 1)
+	assert.Equal(t, cache.DeleteByTag("org:1"), 0)
+	assert.Equal(t, cache.DeleteByTag("unknown"), 0)
+	cache.SyncUpdates()
+	assert.Equal(t, cache.GetSize(), 1)
+}
+
+func Test_CacheTagIndexFollowsItems(t *testing.T) {
+	cache := New(Configure[int]().MaxSize(5).PercentToPrune(1))
+	defer cache.Stop()
+
+	cache.SetWithTags("a", 1, time.Minute, "t")
+	cache.SetWithTags("b", 2, time.Minute, "t")
+	cache.SetWithTags("c", 3, time.Minute, "t")
+	cache.SetWithTags("d", 4, time.Minute, "t")
+	assert.Equal(t, len(cache.tags.items("t")), 4)
+
+	// replacing keeps the tags, setting doesn't
+	assert.Equal(t, cache.Replace("a", 10), true)
+	assert.Equal(t, cache.Get("a").Value(), 10)
+	assert.Equal(t, len(cache.tags.items("t")), 4)
+	cache.Set("b", 20, time.Minute)
+	assert.Equal(t, len(cache.tags.items("t")), 3)
+
+	cache.Delete("c")
+	assert.Equal(t, len(cache.tags.items("t")), 2)
+	cache.SyncUpdates()
+
+	// d is the oldest (a and b were replaced), and gets evicted
+	cache.Set("e", 5, time.Minute)
+	cache.Set("f", 6, time.Minute)
+	cache.Set("g", 7, time.Minute)
+	cache.SyncUpdates()
+	assert.Equal(t, cache.Get("d"), nil)
+	assert.Equal(t, len(cache.tags.items("t")), 1)
+
+	cache.Clear()
+	assert.Equal(t, len(cache.tags.items("t")), 0)
+	assert.Equal(t, len(cache.tags.tags), 0)
+}
+
+func Test_CacheDeletesDependents(t *testing.T) {
+	cache := New(Configure[string]())
+	defer cache.Stop()
+
+	cache.Set("user:1", "leto", time.Minute)
+	cache.Set("template", "<h1>", time.Minute)
+	cache.SetWithDependencies("page:1", "<h1>leto", time.Minute, "user:1", "template")
+	cache.SetWithDependencies("feed", "page:1...", time.Minute, "page:1")
+	cache.Set("page:2", "<h1>", time.Minute)
+
+	// deleting a dependency deletes dependents, transitively
+	cache.Delete("user:1")
+	cache.SyncUpdates()
+	assert.Equal(t, cache.Get("page:1"), nil)
+	assert.Equal(t, cache.Get("feed"), nil)
+	assert.Equal(t, cache.Get("template").Value(), "<h1>")
+	assert.Equal(t, cache.Get("page:2").Value(), "<h1>")
+	assert.Equal(t, cache.GetSize(), 2)
+	assert.Equal(t, len(cache.dependencies.dependents), 0)
+
+	// so does replacing one
+	cache.SetWithDependencies("page:1", "<h1>leto", time.Minute, "template")
+	cache.SyncUpdates()
+	cache.Replace("template", "<h2>")
+	cache.SyncUpdates()
+	assert.Equal(t, cache.Get("page:1"), nil)
+	assert.Equal(t, cache.Get("template").Value(), "<h2>")
+
+	// replacing a dependent keeps its dependencies
+	cache.SetWithDependencies("page:1", "<h2>leto", time.Minute, "template")
+	cache.Replace("page:1", "<h2>ghanima")
+	cache.SyncUpdates()
+	assert.Equal(t, cache.Get("page:1").Value(), "<h2>ghanima")
+	cache.Set("template", "<h3>", time.Minute)
+	cache.SyncUpdates()
+	assert.Equal(t, cache.Get("page:1"), nil)
+	assert.Equal(t, cache.GetSize(), 2)
+}
+
+func Test_CacheDependencyCycles(t *testing.T) {
+	cache := New(Configure[int]())
+	defer cache.Stop()
+
+	cache.SetWithDependencies("a", 1, time.Minute, "c")
+	cache.SetWithDependencies("b", 2, time.Minute, "a")
+	cache.SetWithDependencies("c", 3, time.Minute, "b")
+	cache.SetWithDependencies("d", 4, time.Minute, "d")
+	cache.SyncUpdates()
+
+	cache.Delete("b")
+	cache.SyncUpdates()
+	assert.Equal(t, cache.ItemCount(), 1)
+	assert.Equal(t, cache.GetSize(), 1)
+
+	cache.Delete("d")
+	cache.SyncUpdates()
+	assert.Equal(t, cache.ItemCount(), 0)
+	assert.Equal(t, cache.GetSize(), 0)
+	assert.Equal(t, len(cache.dependencies.dependents), 0)
+}
+
+func Test_CacheEvictingADependencyDeletesDependents(t *testing.T) {
+	cache := New(Configure[int]().MaxSize(3).PercentToPrune(1))
+	defer cache.Stop()
+
+	cache.Set("a", 1, time.Minute)
+	cache.SetWithDependencies("b", 2, time.Minute, "a")
+	cache.Set("c", 3, time.Minute)
+	cache.SyncUpdates()
+	cache.Set("d", 4, time.Minute)
+	cache.SyncUpdates()
+
+	assert.Equal(t, cache.Get("a"), nil)
+	assert.Equal(t, cache.Get("b"), nil)
+	assert.Equal(t, cache.Get("c").Value(), 3)
+	assert.Equal(t, cache.Get("d").Value(), 4)
+	assert.Equal(t, cache.GetSize(), 2)
+	assert.Equal(t, cache.GetDropped(), 1)
+}
+
+func Test_CachePrefixIndex(t *testing.T) {
+	cache := New(Configure[int]().PrefixIndex())
+	defer cache.Stop()
+
+	cache.Set("user:10", 10, time.Minute)
+	cache.Set("user:2", 2, time.Minute)
+	cache.Set("user:1", 1, time.Minute)
+	cache.Set("users", 0, time.Minute)
+	cache.Set("page:1", 100, time.Minute)
+
+	var keys []string
+	cache.ScanPrefix("user:", func(key string, item *Item[int]) bool {
+		keys = append(keys, key)
+		return true
+	})
+	assert.List(t, keys, []string{"user:1", "user:10", "user:2"})
+	assert.Equal(t, cache.CountPrefix("user"), 4)
+	assert.Equal(t, cache.CountPrefix("user:1"), 2)
+	assert.Equal(t, cache.CountPrefix("nope"), 0)
+
+	keys = nil
+	cache.ScanPrefix("", func(key string, item *Item[int]) bool {
+		keys = append(keys, key)
+		return len(keys) < 2
+	})
+	assert.List(t, keys, []string{"page:1", "user:1"})
+
+	assert.Equal(t, cache.DeletePrefix("user:1"), 2)
+	assert.Equal(t, cache.Get("user:1"), nil)
+	assert.Equal(t, cache.Get("user:10"), nil)
+	assert.Equal(t, cache.Get("user:2").Value(), 2)
+	assert.Equal(t, cache.CountPrefix(""), 3)
+	cache.SyncUpdates()
+	assert.Equal(t, cache.GetSize(), 3)
+
+	cache.Delete("user:2")
+	cache.Clear()
+	assert.Equal(t, cache.CountPrefix(""), 0)
+}
+
+func Test_CacheScanPrefixWithoutIndex(t *testing.T) {
+	cache := New(Configure[int]())
+	defer cache.Stop()
+
+	cache.Set("user:1", 1, time.Minute)
+	cache.Set("user:2", 2, time.Minute)
+	cache.Set("page:1", 100, time.Minute)
+
+	sum := 0
+	cache.ScanPrefix("user:", func(key string, item *Item[int]) bool {
+		sum += item.Value()
+		return true
+	})
+	assert.Equal(t, sum, 3)
+	assert.Equal(t, cache.CountPrefix("user:"), 2)
+	assert.Equal(t, cache.CountPrefix("page:"), 1)
+}
+
+func Test_CacheRangeAndScan(t *testing.T) {
+	for _, config := range []*Configuration[int]{Configure[int](), Configure[int]().PrefixIndex()} {
+		cache := New(config)
+		for _, key := range []string{"d", "a", "c", "ba", "b", "e"} {
+			cache.Set(key, 0, time.Minute)
+		}
+
+		var keys []string
+		cache.Range("b", "d", func(key string, item *Item[int]) bool {
+			keys = append(keys, key)
+			return true
+		})
+		assert.List(t, keys, []string{"b", "ba", "c"})
+
+		keys = nil
+		cache.Range("c", "", func(key string, item *Item[int]) bool {
+			keys = append(keys, key)
+			return len(keys) < 2
+		})
+		assert.List(t, keys, []string{"c", "d"})
+
+		items, cursor := cache.Scan("", 4)
+		assert.Equal(t, len(items), 4)
+		assert.Equal(t, items[3].Key(), "c")
+		items, cursor = cache.Scan(cursor, 4)
+		assert.Equal(t, len(items), 2)
+		assert.Equal(t, items[0].Key(), "d")
+		assert.Equal(t, cursor, "")
+		cache.Stop()
+	}
+}
+
+func Test_CacheScanDoesNotSkipStableKeys(t *testing.T) {
+	cache := New(Configure[int]().MaxSize(100000).PrefixIndex())
+	defer cache.Stop()
+
+	for i := 0; i < 1000; i++ {
+		cache.Set(fmt.Sprintf("stable:%04d", i), i, time.Minute)
+	}
+
+	done := make(chan struct{})
+	go func() {
+		for i := 0; ; i++ {
+			select {
+			case <-done:
+				return
+			default:
+			}
+			key := fmt.Sprintf("stable:%04d:%d", rand.Intn(1000), i)
+			cache.Set(key, i, time.Minute)
+			cache.Delete(fmt.Sprintf("stable:%04d:%d", rand.Intn(1000), rand.Intn(i+1)))
+		}
+	}()
+
+	seen := make(map[string]bool)
+	items, cursor := cache.Scan("", 7)
+	for {
+		for _, item := range items {
+			seen[item.Key()] = true
+		}
+		if cursor == "" {
+			break
+		}
+		items, cursor = cache.Scan(cursor, 7)
+	}
+	close(done)
+
+	for i := 0; i < 1000; i++ {
+		assert.True(t, seen[fmt.Sprintf("stable:%04d", i)])
+	}
+}
+
+func Test_CacheIterators(t *testing.T) {
+	cache := New(Configure[int]().GetsPerPromote(1))
+	defer cache.Stop()
+
+	cache.Set("a", 1, time.Minute)
+	cache.Set("b", 2, time.Minute)
+	cache.Set("c", 3, time.Minute)
+
+	values := make(map[string]int)
+	for key, item := range cache.All() {
+		values[key] = item.Value()
+		// safe to use the cache while iterating
+		cache.Replace(key, item.Value()*10)
+	}
+	assert.Equal(t, len(values), 3)
+	assert.Equal(t, values["b"], 2)
+
+	var keys []string
+	for key := range cache.Keys() {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	assert.List(t, keys, []string{"a", "b", "c"})
+
+	sum := 0
+	for value := range cache.Values() {
+		sum += value
+	}
+	assert.Equal(t, sum, 60)
+
+	count := 0
+	for range cache.All() {
+		count += 1
+		break
+	}
+	assert.Equal(t, count, 1)
+}
+
+func Test_CacheByRecency(t *testing.T) {
+	cache := New(Configure[int]().GetsPerPromote(1))
+	defer cache.Stop()
+
+	cache.Set("a", 1, time.Minute)
+	cache.Set("b", 2, time.Minute)
+	cache.Set("c", 3, time.Minute)
+	cache.SyncUpdates()
+	cache.Get("a")
+	cache.SyncUpdates()
+
+	var keys []string
+	for key := range cache.ByRecency() {
+		keys = append(keys, key)
+		if key == "c" {
+			// deleted items are skipped
+			cache.Delete("b")
+		}
+	}
+	assert.List(t, keys, []string{"a", "c"})
+}
+
+func Test_CacheValueIndexes(t *testing.T) {
+	type user struct {
+		email string
+		orgs  []string
+	}
+	cache := New(Configure[*user]().MaxSize(3).PercentToPrune(1).
+		Index("email", func(u *user) []string { return []string{u.email} }).
+		Index("org", func(u *user) []string { return u.orgs }))
+	defer cache.Stop()
+
+	cache.Set("1", &user{email: "leto@dune.gov", orgs: []string{"atreides"}}, time.Minute)
+	cache.Set("2", &user{email: "paul@dune.gov", orgs: []string{"atreides", "fremen"}}, time.Minute)
+	cache.Set("3", &user{email: "stilgar@dune.gov", orgs: []string{"fremen"}}, time.Minute)
+
+	items := cache.GetByIndex("email", "paul@dune.gov")
+	assert.Equal(t, len(items), 1)
+	assert.Equal(t, items[0].Key(), "2")
+	assert.Equal(t, len(cache.GetByIndex("org", "fremen")), 2)
+	assert.Equal(t, len(cache.GetByIndex("org", "harkonnen")), 0)
+	assert.Equal(t, len(cache.GetByIndex("nope", "fremen")), 0)
+
+	// replacing re-indexes the item
+	cache.Replace("2", &user{email: "muaddib@dune.gov", orgs: []string{"fremen"}})
+	assert.Equal(t, len(cache.GetByIndex("email", "paul@dune.gov")), 0)
+	assert.Equal(t, cache.GetByIndex("email", "muaddib@dune.gov")[0].Key(), "2")
+	assert.Equal(t, len(cache.GetByIndex("org", "atreides")), 1)
+
+	cache.Delete("1")
+	assert.Equal(t, len(cache.GetByIndex("org", "atreides")), 0)
+	assert.Equal(t, len(cache.GetByIndex("email", "leto@dune.gov")), 0)
+
+	assert.Equal(t, cache.DeleteByIndex("org", "fremen"), 2)
+	assert.Equal(t, cache.Get("2"), nil)
+	assert.Equal(t, cache.Get("3"), nil)
+	assert.Equal(t, cache.DeleteByIndex("org", "fremen"), 0)
+	assert.Equal(t, cache.DeleteByIndex("nope", "fremen"), 0)
+	cache.SyncUpdates()
+
+	// evicted items leave the index
+	for i := 0; i < 4; i++ {
+		id := strconv.Itoa(i)
+		cache.Set(id, &user{email: id, orgs: []string{"sardaukar"}}, time.Minute)
+		cache.SyncUpdates()
+	}
+	assert.Equal(t, len(cache.GetByIndex("email", "0")), 0)
+	assert.Equal(t, len(cache.GetByIndex("org", "sardaukar")), 3)
+	assert.Equal(t, len(cache.indexes["email"].values), 3)
+}
+
+func Test_CachePinnedItemsAreNotEvicted(t *testing.T) {
+	cache := New(Configure[int]().MaxSize(5).PercentToPrune(1))
+	defer cache.Stop()
+
+	assert.Equal(t, cache.SetPinned("flags", 0, time.Minute), true)
+	cache.Set("config", 1, time.Minute)
+	assert.Equal(t, cache.Pin("config"), true)
+	assert.Equal(t, cache.Pin("config"), true)
+	assert.Equal(t, cache.Pin("nope"), false)
+	assert.Equal(t, cache.Get("config").Pinned(), true)
+	assert.Equal(t, cache.PinnedSize(), 2)
+
+	for i := 0; i < 10; i++ {
+		cache.Set(strconv.Itoa(i), i, time.Minute)
+		cache.SyncUpdates()
+	}
+	assert.Equal(t, cache.Get("flags").Value(), 0)
+	assert.Equal(t, cache.Get("config").Value(), 1)
+	assert.Equal(t, cache.EvictOldest(10), 3)
+	assert.Equal(t, cache.ShrinkTo(0), 0)
+	assert.Equal(t, cache.Get("config").Value(), 1)
+
+	// still honors explicit deletes, and replacing keeps the pin
+	assert.Equal(t, cache.Replace("config", 2), true)
+	assert.Equal(t, cache.Get("config").Pinned(), true)
+	cache.Delete("flags")
+	cache.SyncUpdates()
+	assert.Equal(t, cache.PinnedSize(), 1)
+
+	assert.Equal(t, cache.Unpin("config"), true)
+	assert.Equal(t, cache.Unpin("config"), false)
+	assert.Equal(t, cache.PinnedSize(), 0)
+	assert.Equal(t, cache.EvictOldest(1), 1)
+	assert.Equal(t, cache.Get("config"), nil)
+}
+
+func Test_CacheMaxPinnedSize(t *testing.T) {
+	cache := New(Configure[int]().MaxSize(10))
+	defer cache.Stop()
+
+	// defaults to half of the max size
+	for i := 0; i < 5; i++ {
+		assert.Equal(t, cache.SetPinned(strconv.Itoa(i), i, time.Minute), true)
+	}
+	assert.Equal(t, cache.SetPinned("5", 5, time.Minute), false)
+	assert.Equal(t, cache.Get("5").Pinned(), false)
+	assert.Equal(t, cache.PinnedSize(), 5)
+
+	// replacing a pinned item with Set unpins it
+	cache.Set("0", 0, time.Minute)
+	cache.SyncUpdates()
+	assert.Equal(t, cache.PinnedSize(), 4)
+	assert.Equal(t, cache.Pin("5"), true)
+
+	cache.Clear()
+	assert.Equal(t, cache.PinnedSize(), 0)
+
+	cache = New(Configure[int]().MaxSize(10).MaxPinnedSize(1))
+	defer cache.Stop()
+	assert.Equal(t, cache.SetPinned("a", 1, time.Minute), true)
+	assert.Equal(t, cache.SetPinned("b", 2, time.Minute), false)
+}
+
+func Test_CacheEvictsLowerPrioritiesFirst(t *testing.T) {
+	cache := New(Configure[int]().MaxSize(6).PercentToPrune(1))
+	defer cache.Stop()
+
+	cache.SetWithPriority("report:1", 1, time.Minute, PriorityHigh)
+	cache.SetWithPriority("lookup:1", 2, time.Minute, PriorityLow)
+	cache.Set("page:1", 3, time.Minute)
+	cache.SetWithPriority("lookup:2", 4, time.Minute, PriorityLow)
+	cache.SetWithPriority("report:2", 5, time.Minute, PriorityHigh)
+	cache.Set("page:2", 6, time.Minute)
+	cache.SyncUpdates()
+	assert.Equal(t, cache.Get("report:1").Priority(), PriorityHigh)
+	assert.Equal(t, cache.Get("page:1").Priority(), PriorityNormal)
+
+	var keys []string
+	for key := range cache.ByRecency() {
+		keys = append(keys, key)
+	}
+	assert.List(t, keys, []string{"report:2", "report:1", "page:2", "page:1", "lookup:2", "lookup:1"})
+
+	// low priority items go first, oldest first, then normal ones
+	for i := 0; i < 3; i++ {
+		cache.SetWithPriority("burst:"+strconv.Itoa(i), i, time.Minute, PriorityLow)
+		cache.SyncUpdates()
+	}
+	assert.Equal(t, cache.Get("lookup:1"), nil)
+	assert.Equal(t, cache.Get("lookup:2"), nil)
+	assert.Equal(t, cache.Get("burst:0"), nil)
+	assert.Equal(t, cache.Get("burst:2").Value(), 2)
+	assert.Equal(t, cache.Get("page:1").Value(), 3)
+
+	// Replace briefly adds a second report:1, which mustn't trigger a gc
+	cache.SetMaxSize(100)
+	assert.Equal(t, cache.Replace("report:1", 10), true)
+	assert.Equal(t, cache.Get("report:1").Priority(), PriorityHigh)
+	cache.SyncUpdates()
+
+	// the remaining low priority items, then the normal ones
+	assert.Equal(t, cache.EvictOldest(4), 4)
+	assert.Equal(t, cache.Get("burst:2"), nil)
+	assert.Equal(t, cache.Get("page:1"), nil)
+	assert.Equal(t, cache.Get("page:2"), nil)
+	assert.Equal(t, cache.Get("report:1").Value(), 10)
+	assert.Equal(t, cache.Get("report:2").Value(), 5)
+}
+
+func Test_CacheCostAwareEviction(t *testing.T) {
+	cache := New(Configure[int]().MaxSize(5).PercentToPrune(1).CostAware())
+	defer cache.Stop()
+
+	cache.SetWithCost("report", 1, time.Minute, time.Second)
+	for i := 0; i < 10; i++ {
+		cache.SetWithCost(strconv.Itoa(i), i, time.Minute, time.Millisecond)
+		cache.SyncUpdates()
+	}
+	assert.Equal(t, cache.Get("report").Value(), 1)
+	assert.Equal(t, cache.Get("report").Cost(), time.Second)
+	assert.Equal(t, cache.ItemCount(), 5)
+}
+
+func Test_CacheCostAwareAfterSieveCountsGets(t *testing.T) {
+	cache := New(Configure[int]().MaxSize(3).PercentToPrune(1).GetsPerPromote(1).Sieve().CostAware())
+	defer cache.Stop()
+
+	for _, key := range []string{"a", "b", "c"} {
+		cache.SetWithCost(key, 0, time.Minute, time.Millisecond)
+		cache.SyncUpdates()
+	}
+	for i := 0; i < 5; i++ {
+		cache.Get("a")
+		cache.SyncUpdates()
+	}
+	cache.SetWithCost("d", 0, time.Minute, time.Millisecond)
+	cache.SyncUpdates()
+	assert.Equal(t, cache.ItemCount(), 3)
+	assert.Equal(t, cache.GetWithoutPromote("a").Value(), 0)
+}
+
+func Test_CacheFetchMeasuresCost(t *testing.T) {
+	cache := New(Configure[int]())
+	defer cache.Stop()
+
+	item, _ := cache.Fetch("slow", time.Minute, func() (int, error) {
+		time.Sleep(5 * time.Millisecond)
+		return 1, nil
+	})
+	assert.True(t, item.Cost() >= 5*time.Millisecond)
+	assert.True(t, cache.Get("slow").Cost() >= 5*time.Millisecond)
+
+	assert.Equal(t, cache.Replace("slow", 2), true)
+	assert.True(t, cache.Get("slow").Cost() >= 5*time.Millisecond)
+}
+
+func Test_CacheAdmission(t *testing.T) {
+	cache := New(Configure[string]().
+		Admit(AdmitMaxSize[string](1)).
+		Admit(func(key string, value string, size int64) bool {
+			return key != "banned"
+		}))
+	defer cache.Stop()
+
+	assert.Equal(t, cache.TrySet("a", "1", time.Minute), true)
+	assert.Equal(t, cache.TrySet("banned", "1", time.Minute), false)
+	assert.Equal(t, cache.Get("banned"), nil)
+
+	cache.Set("banned", "1", time.Minute)
+	cache.SetWithPriority("banned", "1", time.Minute, PriorityHigh)
+	assert.Equal(t, cache.SetPinned("banned", "1", time.Minute), false)
+	assert.Equal(t, cache.Get("banned"), nil)
+	assert.Equal(t, cache.PinnedSize(), 0)
+
+	// the value is returned, but not cached
+	item, err := cache.Fetch("banned", time.Minute, func() (string, error) {
+		return "fetched", nil
+	})
+	assert.Nil(t, err)
+	assert.Equal(t, item.Value(), "fetched")
+	assert.Equal(t, cache.Get("banned"), nil)
+
+	// updates are always admitted
+	cache.Setnx("banned", "1", time.Minute)
+	assert.Equal(t, cache.TrySet("banned", "2", time.Minute), true)
+	assert.Equal(t, cache.Get("banned").Value(), "2")
+
+	cache.SyncUpdates()
+	assert.Equal(t, cache.GetSize(), 2)
+}
+
+func Test_CacheAdmissionBySize(t *testing.T) {
+	cache := New(Configure[*SizedItem]().Admit(AdmitMaxSize[*SizedItem](5)))
+	defer cache.Stop()
+
+	assert.Equal(t, cache.TrySet("small", &SizedItem{id: 1, s: 5}, time.Minute), true)
+	assert.Equal(t, cache.TrySet("large", &SizedItem{id: 2, s: 6}, time.Minute), false)
+	cache.SyncUpdates()
+	assert.Equal(t, cache.GetSize(), 5)
+}
+
+func Test_CacheSieveAndClock(t *testing.T) {
+	for _, config := range []*Configuration[int]{Configure[int]().Sieve(), Configure[int]().Clock()} {
+		cache := New(config.MaxSize(5).PercentToPrune(1))
+		for i := 0; i < 5; i++ {
+			cache.Set(strconv.Itoa(i), i, time.Minute)
+		}
+		cache.SyncUpdates()
+		assert.Equal(t, cache.Get("0").Value(), 0)
+
+		for i := 5; i < 10; i++ {
+			cache.Set(strconv.Itoa(i), i, time.Minute)
+			cache.SyncUpdates()
+		}
+		assert.Equal(t, cache.ItemCount(), 5)
+		assert.Equal(t, cache.Get("0").Value(), 0)
+		for i := 1; i < 6; i++ {
+			assert.Equal(t, cache.Get(strconv.Itoa(i)), nil)
+		}
+		cache.Stop()
+	}
+}
+
+func Test_CacheSieveAndClockPurgeExpiredKeepsVisited(t *testing.T) {
+	for _, config := range []*Configuration[int]{Configure[int]().Sieve(), Configure[int]().Clock()} {
+		cache := New(config.MaxSize(5).PercentToPrune(1))
+		for i := 0; i < 5; i++ {
+			cache.Set(strconv.Itoa(i), i, time.Minute)
+		}
+		cache.SyncUpdates()
+		assert.Equal(t, cache.Get("0").Value(), 0)
+
+		// nothing's expired, and "0" must still be considered visited
+		assert.Equal(t, cache.PurgeExpired(), 0)
+		for i := 5; i < 10; i++ {
+			cache.Set(strconv.Itoa(i), i, time.Minute)
+			cache.SyncUpdates()
+		}
+		assert.Equal(t, cache.Get("0").Value(), 0)
+		cache.Stop()
+	}
+}
+
 func Test_ConcurrentStop(t *testing.T) {
 	for i := 0; i < 100; i++ {
 		cache := New(Configure[string]())
@@ -513,9 +1259,10 @@ func Test_ConcurrentClearAndSet(t *testing.T) {
 		// it can only sync what's been written to the buffers.
 		for i := 0; i < 10; i++ {
 			expectedCount := 0
-			if cache.list.Head != nil {
+			cache.policy.keepers(func(item *Item[string]) bool {
 				expectedCount = 1
-			}
+				return false
+			})
 			actualCount := cache.ItemCount()
 			if expectedCount == actualCount {
 				return
@@ -0,0 +1,295 @@
+// ccache-sim replays an access trace through a ccache.Cache, once for every
+// combination of eviction policy, bucket count and max size, and reports the
+// hit ratio, byte hit ratio, evictions and throughput of each run.
+//
+// Every access is a Get and, on a miss, a Set. The cache's own worker does the
+// bookkeeping, as it would in production. By default, the simulator waits for
+// the worker (SyncUpdates) after every access, which makes runs deterministic.
+// A larger -sync lets the worker fall behind, like a busy production cache.
+//
+// Trace formats:
+//
+//	keys  one key per line
+//	csv   key,size,ttl per line (size and ttl, in seconds, are optional)
+//	arc   the ARC traces: "start count ignored ignored" per line, an access
+//	      to each of the count blocks from start
+//	lirs  the LIRS traces: one block number per line
+//
+// Usage:
+//
+//	ccache-sim -trace P8.lis -format arc -sizes 1000,10000 -policies lru,arc
+package main
+
+import (
+	"bufio"
+	"flag"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/karlseguin/ccache/v3"
+)
+
+// The eviction policies which can be simulated
+var policies = map[string]func(config *ccache.Configuration[value]) *ccache.Configuration[value]{
+	"lru": func(config *ccache.Configuration[value]) *ccache.Configuration[value] {
+		return config
+	},
+	"sieve": func(config *ccache.Configuration[value]) *ccache.Configuration[value] {
+		return config.Sieve()
+	},
+	"clock": func(config *ccache.Configuration[value]) *ccache.Configuration[value] {
+		return config.Clock()
+	},
+	"arc": func(config *ccache.Configuration[value]) *ccache.Configuration[value] {
+		return config.ARC()
+	},
+	"gdsf": func(config *ccache.Configuration[value]) *ccache.Configuration[value] {
+		return config.CostAware()
+	},
+}
+
+// A request of the trace
+type access struct {
+	key  string
+	size int64
+	ttl  time.Duration
+}
+
+// What's cached: only its size matters
+type value int64
+
+func (v value) Size() int64 {
+	return int64(v)
+}
+
+type result struct {
+	policy    string
+	buckets   uint32
+	maxSize   int64
+	accesses  int64
+	hits      int64
+	bytes     int64
+	hitBytes  int64
+	evictions int
+	elapsed   time.Duration
+}
+
+func main() {
+	path := flag.String("trace", "", "the trace to replay")
+	format := flag.String("format", "", "keys, csv, arc or lirs (by default, guessed from the trace's extension)")
+	policyNames := flag.String("policies", "lru,sieve,clock,arc,gdsf", "the eviction policies to simulate")
+	bucketCounts := flag.String("buckets", "16", "the bucket counts to simulate")
+	maxSizes := flag.String("sizes", "1000,10000,100000", "the max sizes to simulate")
+	syncEvery := flag.Int("sync", 1, "wait for the cache's worker every this many accesses")
+	ttl := flag.Duration("ttl", time.Hour, "the ttl of items without one in the trace")
+	flag.Parse()
+
+	if err := run(*path, *format, *policyNames, *bucketCounts, *maxSizes, *syncEvery, *ttl, os.Stdout); err != nil {
+		fmt.Fprintln(os.Stderr, "ccache-sim:", err)
+		os.Exit(1)
+	}
+}
+
+func run(path string, format string, policyNames string, bucketCounts string, maxSizes string, syncEvery int, ttl time.Duration, out io.Writer) error {
+	if path == "" {
+		return fmt.Errorf("-trace is required")
+	}
+	if format == "" {
+		format = guessFormat(path)
+	}
+	for _, name := range split(policyNames) {
+		if policies[name] == nil {
+			return fmt.Errorf("unknown policy %q", name)
+		}
+	}
+	buckets, err := parseInts(bucketCounts)
+	if err != nil {
+		return fmt.Errorf("invalid -buckets: %w", err)
+	}
+	for _, b := range buckets {
+		// anything else would silently be turned into 16 by the configuration
+		if b <= 0 || b > math.MaxUint32 || b&(b-1) != 0 {
+			return fmt.Errorf("invalid -buckets: %d isn't a power of 2", b)
+		}
+	}
+	sizes, err := parseInts(maxSizes)
+	if err != nil {
+		return fmt.Errorf("invalid -sizes: %w", err)
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	trace, err := readTrace(f, format, ttl)
+	if err != nil {
+		return err
+	}
+
+	w := tabwriter.NewWriter(out, 0, 0, 2, ' ', tabwriter.AlignRight)
+	fmt.Fprintln(w, "policy\tbuckets\tmax size\thit ratio\tbyte hit ratio\tevictions\taccesses/s\t")
+	for _, name := range split(policyNames) {
+		for _, b := range buckets {
+			for _, size := range sizes {
+				r := simulate(trace, name, uint32(b), size, syncEvery)
+				fmt.Fprintf(w, "%s\t%d\t%d\t%.4f\t%.4f\t%d\t%.0f\t\n",
+					r.policy, r.buckets, r.maxSize,
+					ratio(r.hits, r.accesses), ratio(r.hitBytes, r.bytes),
+					r.evictions, float64(r.accesses)/r.elapsed.Seconds())
+			}
+		}
+	}
+	return w.Flush()
+}
+
+// Replays the trace through a new cache
+func simulate(trace []access, policy string, buckets uint32, maxSize int64, syncEvery int) result {
+	config := ccache.Configure[value]().Buckets(buckets).MaxSize(maxSize)
+	cache := ccache.New(policies[policy](config))
+	defer cache.Stop()
+
+	r := result{policy: policy, buckets: buckets, maxSize: maxSize}
+	start := time.Now()
+	for i, a := range trace {
+		r.accesses += 1
+		r.bytes += a.size
+		if item := cache.Get(a.key); item != nil && !item.Expired() {
+			r.hits += 1
+			r.hitBytes += a.size
+		} else {
+			cache.Set(a.key, value(a.size), a.ttl)
+		}
+		if syncEvery > 0 && (i+1)%syncEvery == 0 {
+			cache.SyncUpdates()
+		}
+	}
+	cache.SyncUpdates()
+	r.elapsed = time.Since(start)
+	r.evictions = cache.GetDropped()
+	return r
+}
+
+func readTrace(r io.Reader, format string, ttl time.Duration) ([]access, error) {
+	var trace []access
+	scanner := bufio.NewScanner(r)
+	for n := 1; scanner.Scan(); n++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		var err error
+		switch format {
+		case "keys":
+			trace = append(trace, access{key: line, size: 1, ttl: ttl})
+		case "lirs":
+			// LIRS traces end with a "*" line
+			if line == "*" {
+				continue
+			}
+			if _, err = strconv.ParseUint(line, 10, 64); err == nil {
+				trace = append(trace, access{key: line, size: 1, ttl: ttl})
+			}
+		case "csv":
+			trace, err = appendCSV(trace, line, ttl)
+		case "arc":
+			trace, err = appendARC(trace, line, ttl)
+		default:
+			return nil, fmt.Errorf("unknown trace format %q", format)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %w", n, err)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return trace, nil
+}
+
+func appendCSV(trace []access, line string, ttl time.Duration) ([]access, error) {
+	fields := strings.Split(line, ",")
+	a := access{key: strings.TrimSpace(fields[0]), size: 1, ttl: ttl}
+	if len(fields) > 1 {
+		size, err := strconv.ParseInt(strings.TrimSpace(fields[1]), 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid size: %w", err)
+		}
+		a.size = size
+	}
+	if len(fields) > 2 {
+		seconds, err := strconv.ParseFloat(strings.TrimSpace(fields[2]), 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid ttl: %w", err)
+		}
+		a.ttl = time.Duration(seconds * float64(time.Second))
+	}
+	return append(trace, a), nil
+}
+
+func appendARC(trace []access, line string, ttl time.Duration) ([]access, error) {
+	fields := strings.Fields(line)
+	if len(fields) < 2 {
+		return nil, fmt.Errorf("expected a starting block and a block count")
+	}
+	start, err := strconv.ParseInt(fields[0], 10, 64)
+	if err != nil {
+		return nil, fmt.Errorf("invalid starting block: %w", err)
+	}
+	count, err := strconv.ParseInt(fields[1], 10, 64)
+	if err != nil {
+		return nil, fmt.Errorf("invalid block count: %w", err)
+	}
+	for block := start; block < start+count; block++ {
+		trace = append(trace, access{key: strconv.FormatInt(block, 10), size: 1, ttl: ttl})
+	}
+	return trace, nil
+}
+
+func guessFormat(path string) string {
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".csv":
+		return "csv"
+	case ".arc", ".lis":
+		return "arc"
+	case ".lirs", ".trc":
+		return "lirs"
+	}
+	return "keys"
+}
+
+func split(list string) []string {
+	var values []string
+	for _, value := range strings.Split(list, ",") {
+		if value = strings.TrimSpace(value); value != "" {
+			values = append(values, value)
+		}
+	}
+	return values
+}
+
+func parseInts(list string) ([]int64, error) {
+	var values []int64
+	for _, value := range split(list) {
+		n, err := strconv.ParseInt(value, 10, 64)
+		if err != nil {
+			return nil, err
+		}
+		values = append(values, n)
+	}
+	return values, nil
+}
+
+func ratio(n int64, total int64) float64 {
+	if total == 0 {
+		return 0
+	}
+	return float64(n) / float64(total)
+}
@@ -0,0 +1,88 @@
+package main
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/karlseguin/ccache/v3/assert"
+)
+
+func Test_ReadTrace_Keys(t *testing.T) {
+	trace, err := readTrace(strings.NewReader("a\n\n# comment\nb\na\n"), "keys", time.Minute)
+	assert.Nil(t, err)
+	assert.Equal(t, len(trace), 3)
+	assert.Equal(t, trace[2], access{key: "a", size: 1, ttl: time.Minute})
+}
+
+func Test_ReadTrace_CSV(t *testing.T) {
+	trace, err := readTrace(strings.NewReader("a,10,2.5\nb,3\nc\n"), "csv", time.Minute)
+	assert.Nil(t, err)
+	assert.Equal(t, len(trace), 3)
+	assert.Equal(t, trace[0], access{key: "a", size: 10, ttl: 2500 * time.Millisecond})
+	assert.Equal(t, trace[1], access{key: "b", size: 3, ttl: time.Minute})
+	assert.Equal(t, trace[2], access{key: "c", size: 1, ttl: time.Minute})
+
+	_, err = readTrace(strings.NewReader("a\nb,x\n"), "csv", time.Minute)
+	assert.Equal(t, err.Error(), `line 2: invalid size: strconv.ParseInt: parsing "x": invalid syntax`)
+}
+
+func Test_ReadTrace_ARC(t *testing.T) {
+	trace, err := readTrace(strings.NewReader("100 3 0 1\n7 1 0 2\n"), "arc", time.Minute)
+	assert.Nil(t, err)
+	keys := make([]string, len(trace))
+	for i, a := range trace {
+		keys[i] = a.key
+	}
+	assert.List(t, keys, []string{"100", "101", "102", "7"})
+}
+
+func Test_ReadTrace_LIRS(t *testing.T) {
+	trace, err := readTrace(strings.NewReader("1\n2\n1\n*\n"), "lirs", time.Minute)
+	assert.Nil(t, err)
+	assert.Equal(t, len(trace), 3)
+
+	_, err = readTrace(strings.NewReader("1\nx\n"), "lirs", time.Minute)
+	assert.True(t, err != nil)
+}
+
+func Test_Simulate(t *testing.T) {
+	var trace []access
+	for i := 0; i < 3; i++ {
+		for _, key := range []string{"a", "b", "c", "d"} {
+			trace = append(trace, access{key: key, size: 1, ttl: time.Minute})
+		}
+	}
+
+	for name := range policies {
+		r := simulate(trace, name, 1, 10, 1)
+		assert.Equal(t, r.accesses, 12)
+		assert.Equal(t, r.hits, 8)
+		assert.Equal(t, r.hitBytes, 8)
+		assert.Equal(t, r.evictions, 0)
+	}
+
+	// a cache that's too small for the loop
+	r := simulate(trace, "lru", 1, 3, 1)
+	assert.Equal(t, r.hits, 0)
+	assert.True(t, r.evictions > 0)
+}
+
+func Test_Run(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "trace.csv")
+	assert.Nil(t, os.WriteFile(path, []byte("a,1\nb,2\na,1\n"), 0644))
+
+	var out bytes.Buffer
+	assert.Nil(t, run(path, "", "lru,arc", "1,16", "10", 1, time.Minute, &out))
+	lines := strings.Split(strings.TrimSpace(out.String()), "\n")
+	assert.Equal(t, len(lines), 5)
+	assert.True(t, strings.Contains(lines[1], "0.3333"))
+	assert.True(t, strings.Contains(lines[1], "0.2500"))
+
+	assert.Equal(t, run(path, "", "lfu", "16", "10", 1, time.Minute, &out).Error(), `unknown policy "lfu"`)
+	assert.Equal(t, run(path, "", "lru", "16,10", "10", 1, time.Minute, &out).Error(), "invalid -buckets: 10 isn't a power of 2")
+	assert.Equal(t, run(path, "", "lru", "0", "10", 1, time.Minute, &out).Error(), "invalid -buckets: 0 isn't a power of 2")
+}
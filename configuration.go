@@ -9,6 +9,25 @@ type Configuration[T any] struct {
 	promoteBuffer  int
 	getsPerPromote int32
 	tracking       bool
+	expiredFirst   bool
+	governor       *memoryGovernor
+	budget         *Budget
+	budgetWeight   int64
+	budgetMinSize  int64
+	maxGroupSize   int64
+	maxGroupItems  int
+	generational   bool
+	prefixIndex    bool
+	indexes        map[string]func(value T) []string
+	maxPinnedSize  int64
+	newPolicy      func() evictionPolicy[T]
+	layeredPolicy  func() evictionPolicy[T]
+	admit          func(key string, value T, size int64) bool
+	visitedBit     bool
+	mrcGhosts      int
+	mrcRate        float64
+	hotKeys        int
+	hotKeysWindow  int
 	onDelete       func(item *Item[T])
 }
 
@@ -25,6 +44,8 @@ func Configure[T any]() *Configuration[T] {
 		promoteBuffer:  1024,
 		maxSize:        5000,
 		tracking:       false,
+		newPolicy:      newPriorityLists[T],
+		layeredPolicy:  newPriorityLists[T],
 	}
 }
 
@@ -99,6 +120,194 @@ func (c *Configuration[T]) Track() *Configuration[T] {
 	return c
 }
 
+// By default, when the cache is full, the least recently used items are pruned,
+// even if other items in the cache have already expired. With PruneExpiredFirst
+// the cache keeps an index of items by expiry, and pruning first removes expired
+// items, falling back to the least recently used ones only if that isn't enough.
+// This costs an extra O(log n) of bookkeeping per insert and delete.
+func (c *Configuration[T]) PruneExpiredFirst() *Configuration[T] {
+	c.expiredFirst = true
+	return c
+}
+
+// MemoryGovernor lets the cache adjust its own max size based on memory pressure.
+// Every second, the live heap is compared to the runtime's soft memory limit
+// (GOMEMLIMIT). When the heap gets within 10% of the limit, the max size is cut
+// by 25%. When it's below 70% of the limit, the max size grows back by 10% of
+// the [min, max] range. The max size is always kept within [min, max]. Without a
+// memory limit, the governor does nothing (beyond clamping the initial MaxSize).
+// Calls to SetMaxSize will be overwritten by the governor.
+func (c *Configuration[T]) MemoryGovernor(min int64, max int64) *Configuration[T] {
+	c.governor = newMemoryGovernor(min, max)
+	return c
+}
+
+// Budget makes the cache share its max size with every other cache configured
+// with the same budget. When the budget is exceeded, the cache which is most
+// over its share (the budget's max size weighted by weight) is pruned. A cache
+// is never pruned below minSize because of the budget. With a budget, the
+// cache's own MaxSize is ignored.
+func (c *Configuration[T]) Budget(budget *Budget, weight int64, minSize int64) *Configuration[T] {
+	c.budget = budget
+	c.budgetWeight = weight
+	c.budgetMinSize = minSize
+	return c
+}
+
+// Only applies to a LayeredCache. Limits the total size of the items which
+// share a primary key. When a group goes over this limit, its own least
+// recently used items are evicted.
+// [0 - no limit]
+func (c *Configuration[T]) MaxGroupSize(size int64) *Configuration[T] {
+	c.maxGroupSize = size
+	return c
+}
+
+// Only applies to a LayeredCache. Limits the number of items which share a
+// primary key. When a group goes over this limit, its own least recently used
+// items are evicted.
+// [0 - no limit]
+func (c *Configuration[T]) MaxGroupItems(count int) *Configuration[T] {
+	c.maxGroupItems = count
+	return c
+}
+
+// Only applies to a LayeredCache. By default, DeleteAll removes every item of
+// the group while holding the group's lock. In generational mode, DeleteAll
+// instead bumps the group's generation, which makes all of its existing items
+// immediately invisible in O(1). The invisible items are reclaimed (and passed
+// to OnDelete) lazily by the cache's worker. Until then, they're still counted
+// by ItemCount, GroupCount and GetSize. This mode also makes Invalidate, which
+// does the same for the entire cache, available.
+func (c *Configuration[T]) Generational() *Configuration[T] {
+	c.generational = true
+	return c
+}
+
+// Only applies to a Cache. Keeps an ordered (radix tree) index of every key, so
+// that DeletePrefix, ScanPrefix and CountPrefix cost the length of the prefix
+// plus the number of matching keys, rather than a scan of every key. This costs
+// an extra index update, under a cache-wide lock, on every insert and delete.
+func (c *Configuration[T]) PrefixIndex() *Configuration[T] {
+	c.prefixIndex = true
+	return c
+}
+
+// Only applies to a Cache. Registers a named index on the cached values. extract
+// returns the values under which an item is indexed (say, a user's email, or
+// the ids of every org it belongs to). Items can then be looked up, or deleted,
+// by those values with GetByIndex and DeleteByIndex. extract is called, once,
+// when an item is added to the cache, while the item's bucket is locked: it
+// should be fast and must not use the cache.
+func (c *Configuration[T]) Index(name string, extract func(value T) []string) *Configuration[T] {
+	if c.indexes == nil {
+		c.indexes = make(map[string]func(value T) []string)
+	}
+	c.indexes[name] = extract
+	return c
+}
+
+// Only applies to a Cache. The maximum total size of pinned items (see
+// Cache.Pin). Pinning an item which would go over this fails. Defaults to
+// half of the cache's max size (at the time of pinning).
+func (c *Configuration[T]) MaxPinnedSize(size int64) *Configuration[T] {
+	c.maxPinnedSize = size
+	return c
+}
+
+// Applies to a Cache and a HierarchicalCache. Uses GreedyDual-Size-Frequency
+// to decide which items to evict: rather than the least recently used items,
+// the cache evicts the items with the lowest cost per unit of size, weighted by
+// how often they're fetched. An item's cost is how long it takes to recompute.
+// It can be given with Cache.SetWithCost, and is measured by Cache.Fetch. Items
+// set any other way have the smallest possible cost. Priorities
+// (SetWithPriority) are ignored.
+func (c *Configuration[T]) CostAware() *Configuration[T] {
+	c.newPolicy = newGDSF[T]
+	c.visitedBit = false
+	return c
+}
+
+// Applies to a Cache and a HierarchicalCache. Uses SIEVE to decide which items
+// to evict. Rather than having the worker move an item to the front of a list
+// when it's fetched, a fetch only sets a flag on the item. When the cache is
+// full, a hand sweeps the items from oldest to newest, clearing the flag of the
+// items which have it and evicting the first one which doesn't. This makes gets
+// a lot cheaper (there's nothing for the worker to do), and SIEVE's hit ratio
+// is typically as good as, or better than, LRU's. GetsPerPromote and priorities
+// are ignored.
+func (c *Configuration[T]) Sieve() *Configuration[T] {
+	c.newPolicy = newSieve[T]
+	c.visitedBit = true
+	return c
+}
+
+// Applies to a Cache and a HierarchicalCache. Like Sieve, but uses CLOCK: when
+// the sweep finds an item which was fetched, the item is moved back to the
+// front (as if it was new) rather than being left in place.
+func (c *Configuration[T]) Clock() *Configuration[T] {
+	c.newPolicy = newClock[T]
+	c.visitedBit = true
+	return c
+}
+
+// Uses the Adaptive Replacement Cache algorithm to decide which items to evict.
+// Items which were only fetched once (GetsPerPromote gets, really) are kept
+// apart from those which were fetched more than once, and evicted first, so a
+// scan of many keys doesn't push out the items which are used often. The cache
+// also remembers the keys it recently evicted. When one of them comes back, it
+// adjusts how much space goes to each kind of item. Applies to a Cache, a
+// LayeredCache and a HierarchicalCache. Priorities (SetWithPriority) are
+// ignored.
+func (c *Configuration[T]) ARC() *Configuration[T] {
+	c.newPolicy = newARC[T]
+	c.layeredPolicy = newARC[T]
+	c.visitedBit = false
+	return c
+}
+
+// Only applies to a Cache. Tracks what's needed to estimate the cache's hit
+// ratio at other sizes (see Cache.MissRatioCurve). The keys of the last
+// ghosts items evicted to make room are kept (without their values): a miss
+// on one of them would have been a hit with a bigger cache. And a sample of
+// sampleRate (0.01 is 1%) of all keys is tracked, to measure how much data is
+// fetched between two gets of the same key. Gets of sampled keys, and misses,
+// take a cache-wide lock, so the lower the sample rate, the cheaper this is.
+func (c *Configuration[T]) TrackMissRatio(ghosts int, sampleRate float64) *Configuration[T] {
+	c.mrcGhosts = ghosts
+	c.mrcRate = sampleRate
+	return c
+}
+
+// Tracks the most accessed keys (see Cache.TopKeys and LayeredCache.TopKeys),
+// over (roughly) the last window accesses. Up to capacity keys are tracked.
+// Accesses are counted by the worker as gets and sets reach it: gets which are
+// skipped because the worker is busy aren't counted, and with Sieve or Clock,
+// only sets are.
+func (c *Configuration[T]) TrackHotKeys(capacity int, window int) *Configuration[T] {
+	c.hotKeys = capacity
+	c.hotKeysWindow = window
+	return c
+}
+
+// Only applies to a Cache. Decides whether a new item is stored at all: when
+// admit returns false, the item is dropped without taking any space or
+// displacing any other item. Updates of keys already in the cache are always
+// admitted. Setnx and Setnx2 aren't subject to admission. TrySet reports
+// whether an item was admitted. Calling Admit more than once requires items to
+// be admitted by every admitter, in the order they were added. See
+// AdmitMaxSize, AdmitOnSecondSighting and AdmitSample for built-in admitters.
+func (c *Configuration[T]) Admit(admit func(key string, value T, size int64) bool) *Configuration[T] {
+	if previous := c.admit; previous != nil {
+		c.admit = func(key string, value T, size int64) bool {
+			return previous(key, value, size) && admit(key, value, size)
+		}
+	} else {
+		c.admit = admit
+	}
+	return c
+}
+
 // OnDelete allows setting a callback function to react to ideam deletion.
 // This typically allows to do a cleanup of resources, such as calling a Close() on
 // cached object that require some kind of tear-down.
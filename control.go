@@ -28,6 +28,57 @@ type controlSyncUpdates struct {
 	done chan struct{}
 }
 
+type controlEvictOldest struct {
+	count int
+	res   chan int
+}
+
+type controlShrinkTo struct {
+	size int64
+	res  chan int
+}
+
+type controlPurgeExpired struct {
+	res chan int
+}
+
+// Sent by a Budget to the cache which is most over its share
+type controlBudgetGC struct {
+}
+
+// Reclaims the items invalidated by a LayeredCache's DeleteAll (for a single
+// primary key) or Invalidate (all), when in generational mode
+type controlReclaim struct {
+	primary string
+	all     bool
+}
+
+// Asks the worker for a snapshot of its list, from the most to the least
+// recently used item. res is a chan []*Item[T] (control messages aren't
+// generic).
+type controlRecency struct {
+	res interface{}
+}
+
+// Pins, or unpins, an item. When pinning, previous can be an item whose pin
+// is transferred to item (it's unpinned first). item and previous are *Item[T]
+// (control messages aren't generic).
+type controlPin struct {
+	item     interface{}
+	previous interface{}
+	pin      bool
+	res      chan bool
+}
+
+type controlMissRatioCurve struct {
+	res chan []MissRatioPoint
+}
+
+type controlTopKeys struct {
+	n   int
+	res chan []HotKey
+}
+
 type control chan interface{}
 
 func newControl() chan interface{} {
@@ -72,7 +123,8 @@ func (c control) GetSize() int64 {
 }
 
 // Gets the number of items removed from the cache due to memory pressure since
-// the last time GetDropped was called
+// the last time GetDropped was called. Items removed by EvictOldest, ShrinkTo
+// or PurgeExpired aren't counted (those return their own count).
 // This is a control command.
 func (c control) GetDropped() int {
 	res := make(chan int)
@@ -108,3 +160,33 @@ func (c control) SyncUpdates() {
 	c <- controlSyncUpdates{done: done}
 	<-done
 }
+
+// Evicts up to count items, starting with the least recently used one. Items
+// which are being tracked (see Track()) are skipped. Returns the number of
+// items removed. The OnDelete callback is called for each removed item.
+// This is a control command.
+func (c control) EvictOldest(count int) int {
+	res := make(chan int)
+	c <- controlEvictOldest{count: count, res: res}
+	return <-res
+}
+
+// Evicts items, starting with the least recently used one, until the size of
+// the cache is less than or equal to size. Unlike SetMaxSize, this is a one-off
+// operation: the configured max size is left as-is. Returns the number of items
+// removed. The OnDelete callback is called for each removed item.
+// This is a control command.
+func (c control) ShrinkTo(size int64) int {
+	res := make(chan int)
+	c <- controlShrinkTo{size: size, res: res}
+	return <-res
+}
+
+// Removes all expired items from the cache. Returns the number of items
+// removed. The OnDelete callback is called for each removed item.
+// This is a control command.
+func (c control) PurgeExpired() int {
+	res := make(chan int)
+	c <- controlPurgeExpired{res: res}
+	return <-res
+}
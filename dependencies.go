@@ -0,0 +1,65 @@
+package ccache
+
+import "sync"
+
+// Maps a key to the items which depend on it (items set via
+// SetWithDependencies). An item's edges are added when it's set, before it's
+// visible, and removed by the worker when it processes the item's removal.
+// Edges point to items, not keys, so that a dependent which has since been
+// replaced isn't invalidated on behalf of its replacement.
+type dependencyGraph[T any] struct {
+	sync.Mutex
+	dependents map[string]map[*Item[T]]struct{}
+}
+
+func newDependencyGraph[T any]() *dependencyGraph[T] {
+	return &dependencyGraph[T]{dependents: make(map[string]map[*Item[T]]struct{})}
+}
+
+func (g *dependencyGraph[T]) add(item *Item[T]) {
+	g.Lock()
+	for _, key := range item.dependencies() {
+		dependents := g.dependents[key]
+		if dependents == nil {
+			dependents = make(map[*Item[T]]struct{})
+			g.dependents[key] = dependents
+		}
+		dependents[item] = struct{}{}
+	}
+	g.Unlock()
+}
+
+func (g *dependencyGraph[T]) remove(item *Item[T]) {
+	dependencies := item.dependencies()
+	if len(dependencies) == 0 {
+		return
+	}
+	g.Lock()
+	for _, key := range dependencies {
+		dependents := g.dependents[key]
+		if dependents == nil {
+			continue
+		}
+		delete(dependents, item)
+		if len(dependents) == 0 {
+			delete(g.dependents, key)
+		}
+	}
+	g.Unlock()
+}
+
+// Removes, and returns, the items which depend on key
+func (g *dependencyGraph[T]) take(key string) []*Item[T] {
+	g.Lock()
+	defer g.Unlock()
+	dependents := g.dependents[key]
+	if len(dependents) == 0 {
+		return nil
+	}
+	delete(g.dependents, key)
+	items := make([]*Item[T], 0, len(dependents))
+	for item := range dependents {
+		items = append(items, item)
+	}
+	return items
+}
@@ -0,0 +1,90 @@
+package ccache
+
+import (
+	"container/heap"
+	"sync/atomic"
+)
+
+// A min-heap of items ordered by their expiry. Used by the worker (and only
+// the worker) when the PruneExpiredFirst() option is configured so that
+// gc can find expired items without scanning the entire list.
+
+// The heap orders items by the expiry they had when they were indexed. An
+// item's expiry can be changed concurrently via Extend, in which case the
+// indexed value is stale. popExpired deals with items which were extended
+// (their real expiry is later than the indexed one) by re-indexing them. Items
+// whose expiry was shortened are only seen as expired once their original
+// expiry is reached (or via the normal LRU pruning).
+type expiries[T any] struct {
+	items []*Item[T]
+}
+
+func newExpiries[T any]() *expiries[T] {
+	return &expiries[T]{}
+}
+
+func (e *expiries[T]) push(item *Item[T]) {
+	item.workerState().indexedExpires = atomic.LoadInt64(&item.expires)
+	heap.Push(e, item)
+}
+
+func (e *expiries[T]) remove(item *Item[T]) {
+	if item.state == nil {
+		return
+	}
+	index := item.state.expiryIndex
+	if index < 0 || index >= len(e.items) || e.items[index] != item {
+		return
+	}
+	heap.Remove(e, index)
+}
+
+// Pops and returns the item with the earliest expiry, provided it expired
+// before now. Returns nil if no indexed item is expired.
+func (e *expiries[T]) popExpired(now int64) *Item[T] {
+	for len(e.items) > 0 {
+		item := e.items[0]
+		if item.state.indexedExpires >= now {
+			return nil
+		}
+		if expires := atomic.LoadInt64(&item.expires); expires >= now {
+			// extended since it was indexed
+			item.state.indexedExpires = expires
+			heap.Fix(e, 0)
+			continue
+		}
+		return heap.Pop(e).(*Item[T])
+	}
+	return nil
+}
+
+func (e *expiries[T]) Len() int {
+	return len(e.items)
+}
+
+func (e *expiries[T]) Less(i, j int) bool {
+	return e.items[i].state.indexedExpires < e.items[j].state.indexedExpires
+}
+
+func (e *expiries[T]) Swap(i, j int) {
+	items := e.items
+	items[i], items[j] = items[j], items[i]
+	items[i].state.expiryIndex = i
+	items[j].state.expiryIndex = j
+}
+
+func (e *expiries[T]) Push(x interface{}) {
+	item := x.(*Item[T])
+	item.state.expiryIndex = len(e.items)
+	e.items = append(e.items, item)
+}
+
+func (e *expiries[T]) Pop() interface{} {
+	items := e.items
+	l := len(items) - 1
+	item := items[l]
+	items[l] = nil
+	item.state.expiryIndex = -1
+	e.items = items[:l]
+	return item
+}
@@ -0,0 +1,52 @@
+package ccache
+
+import (
+	"testing"
+	"time"
+
+	"github.com/karlseguin/ccache/v3/assert"
+)
+
+func Test_Expiries_PopsInExpiryOrder(t *testing.T) {
+	e := newExpiries[int]()
+	now := time.Now().UnixNano()
+	e.push(newItem("c", 3, now-10, false))
+	e.push(newItem("live", 4, now+int64(time.Minute), false))
+	e.push(newItem("a", 1, now-30, false))
+	e.push(newItem("b", 2, now-20, false))
+
+	assert.Equal(t, e.popExpired(now).key, "a")
+	assert.Equal(t, e.popExpired(now).key, "b")
+	assert.Equal(t, e.popExpired(now).key, "c")
+	assert.Equal(t, e.popExpired(now), nil)
+	assert.Equal(t, e.Len(), 1)
+}
+
+func Test_Expiries_Remove(t *testing.T) {
+	e := newExpiries[int]()
+	now := time.Now().UnixNano()
+	a := newItem("a", 1, now-30, false)
+	b := newItem("b", 2, now-20, false)
+	e.push(a)
+	e.push(b)
+
+	e.remove(a)
+	assert.Equal(t, a.state.expiryIndex, -1)
+	// removing an item that isn't in the heap is a noop
+	e.remove(a)
+	assert.Equal(t, e.popExpired(now).key, "b")
+	assert.Equal(t, e.popExpired(now), nil)
+}
+
+func Test_Expiries_ReindexesExtendedItems(t *testing.T) {
+	e := newExpiries[int]()
+	now := time.Now().UnixNano()
+	a := newItem("a", 1, now-30, false)
+	e.push(a)
+	e.push(newItem("b", 2, now-20, false))
+
+	a.Extend(time.Minute)
+	assert.Equal(t, e.popExpired(now).key, "b")
+	assert.Equal(t, e.popExpired(now), nil)
+	assert.Equal(t, e.Len(), 1)
+}
@@ -0,0 +1,130 @@
+package ccache
+
+import (
+	"container/heap"
+	"sort"
+)
+
+// GreedyDual-Size-Frequency, enabled with the CostAware() option. Every item
+// gets a score of:
+//
+//	clock + frequency * cost / size
+//
+// and the item with the lowest score is evicted first. So items which are cheap
+// to recompute, relative to how much space they take, go first, unless they're
+// fetched often. clock is the score of the last evicted item. Since it only
+// grows, items which haven't been promoted in a while eventually fall behind
+// newer ones, which is what keeps a formerly expensive and popular item from
+// staying in the cache forever.
+type gdsf[T any] struct {
+	items []*Item[T]
+	clock float64
+}
+
+func newGDSF[T any]() evictionPolicy[T] {
+	return &gdsf[T]{}
+}
+
+func (g *gdsf[T]) insert(item *Item[T]) {
+	item.inList = true
+	state := item.workerState()
+	state.frequency = 1
+	state.score = g.score(item)
+	heap.Push(g, item)
+}
+
+func (g *gdsf[T]) promote(item *Item[T]) {
+	state := item.workerState()
+	state.frequency += 1
+	state.score = g.score(item)
+	heap.Fix(g, state.policyIndex)
+}
+
+func (g *gdsf[T]) remove(item *Item[T]) {
+	item.inList = false
+	if item.state == nil {
+		return
+	}
+	index := item.state.policyIndex
+	if index < 0 || index >= len(g.items) || g.items[index] != item {
+		return
+	}
+	heap.Remove(g, index)
+}
+
+func (g *gdsf[T]) victims(fn func(item *Item[T]) bool) {
+	// items which fn didn't remove (because they can't be evicted) are taken
+	// out of the heap so that we can get to the next one, and put back after
+	var held []*Item[T]
+	for len(g.items) > 0 {
+		item := g.items[0]
+		keepGoing := fn(item)
+		if len(g.items) > 0 && g.items[0] == item {
+			held = append(held, heap.Pop(g).(*Item[T]))
+		} else if item.state.score > g.clock {
+			g.clock = item.state.score
+		}
+		if !keepGoing {
+			break
+		}
+	}
+	for _, item := range held {
+		heap.Push(g, item)
+	}
+}
+
+func (g *gdsf[T]) keepers(fn func(item *Item[T]) bool) {
+	items := make([]*Item[T], len(g.items))
+	copy(items, g.items)
+	sort.Slice(items, func(i, j int) bool {
+		return items[i].state.score > items[j].state.score
+	})
+	for _, item := range items {
+		if !fn(item) {
+			return
+		}
+	}
+}
+
+func (g *gdsf[T]) score(item *Item[T]) float64 {
+	size := item.size
+	if size < 1 {
+		size = 1
+	}
+	cost := int64(item.Cost())
+	if cost < 1 {
+		cost = 1
+	}
+	return g.clock + float64(item.state.frequency)*float64(cost)/float64(size)
+}
+
+func (g *gdsf[T]) Len() int {
+	return len(g.items)
+}
+
+func (g *gdsf[T]) Less(i, j int) bool {
+	return g.items[i].state.score < g.items[j].state.score
+}
+
+func (g *gdsf[T]) Swap(i, j int) {
+	items := g.items
+	items[i], items[j] = items[j], items[i]
+	items[i].state.policyIndex = i
+	items[j].state.policyIndex = j
+}
+
+func (g *gdsf[T]) Push(x interface{}) {
+	item := x.(*Item[T])
+	item.state.policyIndex = len(g.items)
+	g.items = append(g.items, item)
+}
+
+func (g *gdsf[T]) Pop() interface{} {
+	items := g.items
+	l := len(items) - 1
+	item := items[l]
+	items[l] = nil
+	item.state.policyIndex = -1
+	g.items = items[:l]
+	return item
+}
@@ -0,0 +1,93 @@
+package ccache
+
+import (
+	"testing"
+	"time"
+
+	"github.com/karlseguin/ccache/v3/assert"
+)
+
+func Test_GDSF_EvictsLowestCostPerSizeFirst(t *testing.T) {
+	g := newGDSF[int]().(*gdsf[int])
+	cheap := gdsfItem("cheap", 1, time.Millisecond)
+	big := gdsfItem("big", 100, time.Second)
+	small := gdsfItem("small", 1, time.Second)
+	g.insert(small)
+	g.insert(big)
+	g.insert(cheap)
+
+	assert.List(t, gdsfVictims(g), []string{"cheap", "big", "small"})
+	assert.List(t, gdsfKeepers(g), []string{"small", "big", "cheap"})
+
+	// frequently used items are worth more
+	for i := 0; i < 2000; i++ {
+		g.promote(cheap)
+	}
+	assert.List(t, gdsfVictims(g), []string{"big", "small", "cheap"})
+}
+
+func Test_GDSF_AgesItemsOnEviction(t *testing.T) {
+	g := newGDSF[int]().(*gdsf[int])
+	old := gdsfItem("old", 1, 10*time.Millisecond)
+	victim := gdsfItem("victim", 1, 5*time.Millisecond)
+	g.insert(old)
+	g.insert(victim)
+
+	g.victims(func(item *Item[int]) bool {
+		g.remove(item)
+		return false
+	})
+	assert.Equal(t, g.clock, float64(5*time.Millisecond))
+	assert.Equal(t, g.Len(), 1)
+
+	// a new item, even with a lower cost, now outranks the old one
+	young := gdsfItem("young", 1, 6*time.Millisecond)
+	g.insert(young)
+	assert.List(t, gdsfVictims(g), []string{"old", "young"})
+}
+
+func Test_GDSF_SkipsItemsWhichArentRemoved(t *testing.T) {
+	g := newGDSF[int]().(*gdsf[int])
+	g.insert(gdsfItem("a", 1, 1))
+	g.insert(gdsfItem("b", 1, 2))
+	g.insert(gdsfItem("c", 1, 3))
+
+	var removed []string
+	g.victims(func(item *Item[int]) bool {
+		if item.key != "a" {
+			removed = append(removed, item.key)
+			g.remove(item)
+		}
+		return len(removed) < 2
+	})
+	assert.List(t, removed, []string{"b", "c"})
+	assert.Equal(t, g.Len(), 1)
+	assert.Equal(t, g.items[0].key, "a")
+	assert.Equal(t, g.items[0].inList, true)
+}
+
+func gdsfItem(key string, size int64, cost time.Duration) *Item[int] {
+	item := newItem(key, 0, 0, false)
+	item.size = size
+	item.extend().cost = int64(cost)
+	return item
+}
+
+// the order in which items would be evicted, without evicting them
+func gdsfVictims(g *gdsf[int]) []string {
+	var keys []string
+	g.victims(func(item *Item[int]) bool {
+		keys = append(keys, item.key)
+		return true
+	})
+	return keys
+}
+
+func gdsfKeepers(g *gdsf[int]) []string {
+	var keys []string
+	g.keepers(func(item *Item[int]) bool {
+		keys = append(keys, item.key)
+		return true
+	})
+	return keys
+}
@@ -1,3 +1,3 @@
 module github.com/karlseguin/ccache/v3
 
-go 1.19
+go 1.23
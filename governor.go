@@ -0,0 +1,139 @@
+package ccache
+
+import (
+	"math"
+	"runtime/metrics"
+	"time"
+)
+
+const (
+	// when the live heap is above this fraction of the memory limit, the cache
+	// shrinks its max size
+	governorHighWatermark = 0.90
+
+	// when the live heap is below this fraction of the memory limit, the cache
+	// grows its max size
+	governorLowWatermark = 0.70
+)
+
+// Periodically adjusts a cache's max size based on how close the live heap is
+// to the runtime's soft memory limit (GOMEMLIMIT or debug.SetMemoryLimit).
+// Under pressure, the max size is cut by a quarter. With plenty of headroom
+// it grows by a tenth of the configured range. In between, or when no memory
+// limit is set, it's left alone. The max size always stays within [min, max].
+type memoryGovernor struct {
+	min      int64
+	max      int64
+	interval time.Duration
+	read     func() (live uint64, limit uint64)
+}
+
+func newMemoryGovernor(min int64, max int64) *memoryGovernor {
+	if max < min {
+		max = min
+	}
+	return &memoryGovernor{
+		min:      min,
+		max:      max,
+		interval: time.Second,
+		read:     readMemoryMetrics,
+	}
+}
+
+// Runs until stopped is closed. Changes are applied by sending a
+// controlSetMaxSize to the cache's worker, exactly like SetMaxSize does.
+func (g *memoryGovernor) run(cc control, stopped chan struct{}, maxSize int64) {
+	current := g.clamp(maxSize)
+	if current != maxSize && !g.setMaxSize(cc, stopped, current) {
+		return
+	}
+
+	ticker := time.NewTicker(g.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-stopped:
+			return
+		case <-ticker.C:
+			live, limit := g.read()
+			next := g.nextSize(current, live, limit)
+			if next == current {
+				continue
+			}
+			if !g.setMaxSize(cc, stopped, next) {
+				return
+			}
+			current = next
+		}
+	}
+}
+
+func (g *memoryGovernor) nextSize(current int64, live uint64, limit uint64) int64 {
+	if limit == 0 || limit == math.MaxInt64 || live == 0 {
+		// no memory limit, or no stats, nothing to govern against
+		return current
+	}
+
+	usage := float64(live) / float64(limit)
+	if usage >= governorHighWatermark {
+		return g.clamp(current - current/4)
+	}
+	if usage <= governorLowWatermark {
+		step := (g.max - g.min) / 10
+		if step == 0 {
+			step = 1
+		}
+		return g.clamp(current + step)
+	}
+	return current
+}
+
+func (g *memoryGovernor) clamp(size int64) int64 {
+	if size < g.min {
+		return g.min
+	}
+	if size > g.max {
+		return g.max
+	}
+	return size
+}
+
+// Like control.SetMaxSize, but gives up if the cache is stopped while we're
+// waiting on the worker.
+func (g *memoryGovernor) setMaxSize(cc control, stopped chan struct{}, size int64) bool {
+	done := make(chan struct{})
+	select {
+	case cc <- controlSetMaxSize{size: size, done: done}:
+	case <-stopped:
+		return false
+	}
+	select {
+	case <-done:
+		return true
+	case <-stopped:
+		return false
+	}
+}
+
+func readMemoryMetrics() (uint64, uint64) {
+	samples := []metrics.Sample{
+		{Name: "/gc/heap/live:bytes"},
+		{Name: "/memory/classes/heap/objects:bytes"},
+		{Name: "/gc/gomemlimit:bytes"},
+	}
+	metrics.Read(samples)
+
+	var live, limit uint64
+	if s := samples[0]; s.Value.Kind() == metrics.KindUint64 {
+		live = s.Value.Uint64()
+	} else if s := samples[1]; s.Value.Kind() == metrics.KindUint64 {
+		// older runtimes don't expose the live heap, this includes
+		// unswept garbage, but is close enough
+		live = s.Value.Uint64()
+	}
+	if s := samples[2]; s.Value.Kind() == metrics.KindUint64 {
+		limit = s.Value.Uint64()
+	}
+	return live, limit
+}
@@ -0,0 +1,97 @@
+package ccache
+
+import (
+	"math"
+	"strconv"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/karlseguin/ccache/v3/assert"
+)
+
+func Test_MemoryGovernor_NextSize(t *testing.T) {
+	g := newMemoryGovernor(100, 1100)
+
+	// no limit
+	assert.Equal(t, g.nextSize(500, 900, math.MaxInt64), 500)
+	assert.Equal(t, g.nextSize(500, 0, 1000), 500)
+
+	// under pressure
+	assert.Equal(t, g.nextSize(500, 900, 1000), 375)
+	assert.Equal(t, g.nextSize(120, 950, 1000), 100)
+
+	// between watermarks
+	assert.Equal(t, g.nextSize(500, 800, 1000), 500)
+
+	// plenty of headroom
+	assert.Equal(t, g.nextSize(500, 700, 1000), 600)
+	assert.Equal(t, g.nextSize(1050, 100, 1000), 1100)
+}
+
+func Test_MemoryGovernor_ClampsInitialSize(t *testing.T) {
+	g := newMemoryGovernor(10, 20)
+	g.read = func() (uint64, uint64) { return 0, 0 }
+
+	cache := New(Configure[int]().MaxSize(100))
+	defer cache.Stop()
+	for i := 0; i < 30; i++ {
+		cache.Set(strconv.Itoa(i), i, time.Minute)
+	}
+	cache.SyncUpdates()
+
+	go g.run(cache.control, cache.stopped, 100)
+	waitFor(t, func() bool { return cache.GetSize() <= 20 })
+}
+
+func Test_MemoryGovernor_ShrinksUnderPressure(t *testing.T) {
+	pressure := int32(1)
+	g := newMemoryGovernor(5, 50)
+	g.interval = time.Millisecond
+	g.read = func() (uint64, uint64) {
+		if atomic.LoadInt32(&pressure) == 1 {
+			return 95, 100
+		}
+		return 10, 100
+	}
+
+	cache := Layered(Configure[int]().MaxSize(50).PercentToPrune(1))
+	defer cache.Stop()
+	for i := 0; i < 50; i++ {
+		cache.Set(strconv.Itoa(i), "a", i, time.Minute)
+	}
+	cache.SyncUpdates()
+
+	go g.run(cache.control, cache.stopped, 50)
+	waitFor(t, func() bool { return cache.GetSize() == 5 })
+
+	atomic.StoreInt32(&pressure, 0)
+	waitFor(t, func() bool {
+		for i := 0; i < 50; i++ {
+			cache.Set(strconv.Itoa(i), "b", i, time.Minute)
+		}
+		cache.SyncUpdates()
+		return cache.GetSize() == 50
+	})
+}
+
+func Test_MemoryGovernor_StopsWithTheCache(t *testing.T) {
+	cache := New(Configure[int]().MemoryGovernor(1, 10))
+	cache.Stop()
+	select {
+	case <-cache.stopped:
+	case <-time.After(time.Second):
+		t.Fatal("worker didn't stop")
+	}
+}
+
+func waitFor(t *testing.T, fn func() bool) {
+	t.Helper()
+	for i := 0; i < 500; i++ {
+		if fn() {
+			return
+		}
+		time.Sleep(time.Millisecond * 2)
+	}
+	t.Fatal("condition never became true")
+}
@@ -0,0 +1,205 @@
+package ccache
+
+import (
+	"sync"
+	"time"
+)
+
+// A tree of nodes, keyed by the components of an item's path. Any node can
+// hold an item, so both ["a"] and ["a", "b"] can be set. Nodes which have
+// neither an item nor children are removed.
+type hierarchicalBucket[T any] struct {
+	sync.RWMutex
+	root *hierarchicalNode[T]
+	// the number of items in the tree
+	count int
+}
+
+type hierarchicalNode[T any] struct {
+	item     *Item[T]
+	children map[string]*hierarchicalNode[T]
+}
+
+func newHierarchicalBucket[T any]() *hierarchicalBucket[T] {
+	return &hierarchicalBucket[T]{root: newHierarchicalNode[T]()}
+}
+
+func newHierarchicalNode[T any]() *hierarchicalNode[T] {
+	return &hierarchicalNode[T]{children: make(map[string]*hierarchicalNode[T])}
+}
+
+func (b *hierarchicalBucket[T]) itemCount() int {
+	b.RLock()
+	defer b.RUnlock()
+	return b.count
+}
+
+func (b *hierarchicalBucket[T]) get(path []string) *Item[T] {
+	b.RLock()
+	defer b.RUnlock()
+	node := b.root.find(path)
+	if node == nil {
+		return nil
+	}
+	return node.item
+}
+
+func (b *hierarchicalBucket[T]) set(path []string, value T, duration time.Duration, track bool) (*Item[T], *Item[T]) {
+	expires := time.Now().Add(duration).UnixNano()
+	item := newItem(path[len(path)-1], value, expires, track)
+	item.extend().path = path
+
+	b.Lock()
+	defer b.Unlock()
+	node := b.root
+	for _, key := range path {
+		child, exists := node.children[key]
+		if !exists {
+			child = newHierarchicalNode[T]()
+			node.children[key] = child
+		}
+		node = child
+	}
+	existing := node.item
+	node.item = item
+	if existing == nil {
+		b.count += 1
+	}
+	return item, existing
+}
+
+func (b *hierarchicalBucket[T]) remove(path []string) *Item[T] {
+	b.Lock()
+	defer b.Unlock()
+	nodes := b.root.trail(path)
+	if nodes == nil {
+		return nil
+	}
+	node := nodes[len(nodes)-1]
+	item := node.item
+	if item != nil {
+		node.item = nil
+		b.count -= 1
+	}
+	b.prune(path, nodes)
+	return item
+}
+
+// Unlike remove, only removes the item if it's still the one stored at its
+// path (it could have been replaced since the worker got it).
+func (b *hierarchicalBucket[T]) delete(item *Item[T]) {
+	b.Lock()
+	defer b.Unlock()
+	nodes := b.root.trail(item.path())
+	if nodes == nil {
+		return
+	}
+	node := nodes[len(nodes)-1]
+	if node.item != item {
+		return
+	}
+	node.item = nil
+	b.count -= 1
+	b.prune(item.path(), nodes)
+}
+
+// Detaches the subtree under prefix (including any item at prefix itself)
+// while holding the lock, then sends every item of the detached subtree to
+// deletables after releasing it.
+func (b *hierarchicalBucket[T]) deleteAll(prefix []string, deletables chan *Item[T]) int {
+	b.Lock()
+	nodes := b.root.trail(prefix)
+	if nodes == nil {
+		b.Unlock()
+		return 0
+	}
+	l := len(prefix)
+	var items []*Item[T]
+	nodes[l].walk(func(item *Item[T]) bool {
+		items = append(items, item)
+		return true
+	})
+	delete(nodes[l-1].children, prefix[l-1])
+	b.prune(prefix[:l-1], nodes[:l])
+	b.count -= len(items)
+	b.Unlock()
+
+	for _, item := range items {
+		deletables <- item
+	}
+	return len(items)
+}
+
+func (b *hierarchicalBucket[T]) forEachFunc(prefix []string, matches func(path []string, item *Item[T]) bool) bool {
+	b.RLock()
+	defer b.RUnlock()
+	node := b.root.find(prefix)
+	if node == nil {
+		return true
+	}
+	return node.walk(func(item *Item[T]) bool {
+		return matches(item.path(), item)
+	})
+}
+
+// Removes empty nodes, from the bottom of the trail up. nodes[i+1] is the
+// child of nodes[i] for path[i]. We expect the caller to have acquired a
+// write lock.
+func (b *hierarchicalBucket[T]) prune(path []string, nodes []*hierarchicalNode[T]) {
+	for i := len(path); i > 0; i-- {
+		node := nodes[i]
+		if node.item != nil || len(node.children) != 0 {
+			return
+		}
+		delete(nodes[i-1].children, path[i-1])
+	}
+}
+
+// we expect the caller to have acquired a write lock
+func (b *hierarchicalBucket[T]) clear() {
+	b.root.walk(func(item *Item[T]) bool {
+		item.promotions = -2
+		return true
+	})
+	b.root = newHierarchicalNode[T]()
+	b.count = 0
+}
+
+func (n *hierarchicalNode[T]) find(path []string) *hierarchicalNode[T] {
+	node := n
+	for _, key := range path {
+		node = node.children[key]
+		if node == nil {
+			return nil
+		}
+	}
+	return node
+}
+
+// Returns every node from n (inclusive) to the node at path, or nil if there
+// is no node at path.
+func (n *hierarchicalNode[T]) trail(path []string) []*hierarchicalNode[T] {
+	nodes := make([]*hierarchicalNode[T], 0, len(path)+1)
+	nodes = append(nodes, n)
+	node := n
+	for _, key := range path {
+		node = node.children[key]
+		if node == nil {
+			return nil
+		}
+		nodes = append(nodes, node)
+	}
+	return nodes
+}
+
+func (n *hierarchicalNode[T]) walk(fn func(item *Item[T]) bool) bool {
+	if n.item != nil && !fn(n.item) {
+		return false
+	}
+	for _, child := range n.children {
+		if !child.walk(fn) {
+			return false
+		}
+	}
+	return true
+}
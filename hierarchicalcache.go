@@ -0,0 +1,289 @@
+package ccache
+
+import (
+	"hash/fnv"
+	"sync/atomic"
+	"time"
+)
+
+type HierarchicalCache[T any] struct {
+	*Configuration[T]
+	control
+	cacheWorker[T]
+	buckets    []*hierarchicalBucket[T]
+	bucketMask uint32
+}
+
+// Create a new hierarchical cache with the specified configuration.
+// A hierarchical cache is a generalization of the layered cache: values are
+// identified by a path of keys of any depth, rather than exactly a primary and
+// a secondary key. DeleteAll deletes an entire subtree at any level.
+
+// For example, as an HTTP cache:
+// path 1 = ["example.com", "/users/44", ".json"]
+// path 2 = ["example.com", "/users/44", ".xml"]
+// DeleteAll("example.com", "/users/44") deletes both variants, while
+// DeleteAll("example.com") deletes everything cached for the host.
+
+// Paths are sharded by their first key, so all of the paths which share a
+// first key are in the same bucket. Nodes can hold a value and have children,
+// so both ["a"] and ["a", "b"] can be set.
+
+// See ccache.Configure() for creating a configuration
+func Hierarchical[T any](config *Configuration[T]) *HierarchicalCache[T] {
+	c := &HierarchicalCache[T]{
+		Configuration: config,
+		control:       newControl(),
+		bucketMask:    uint32(config.buckets) - 1,
+		buckets:       make([]*hierarchicalBucket[T], config.buckets),
+	}
+	c.cacheWorker = newCacheWorker[T](c, config, c.control, config.newPolicy)
+	for i := 0; i < config.buckets; i++ {
+		c.buckets[i] = newHierarchicalBucket[T]()
+	}
+	c.start()
+	return c
+}
+
+func (c *HierarchicalCache[T]) ItemCount() int {
+	count := 0
+	for _, b := range c.buckets {
+		count += b.itemCount()
+	}
+	return count
+}
+
+// Get an item from the cache. Returns nil if the item wasn't found.
+// This can return an expired item. Use item.Expired() to see if the item
+// is expired and item.TTL() to see how long until the item expires (which
+// will be negative for an already expired item).
+func (c *HierarchicalCache[T]) Get(path ...string) *Item[T] {
+	if len(path) == 0 {
+		return nil
+	}
+	item := c.bucket(path[0]).get(path)
+	if item == nil {
+		return nil
+	}
+	if item.expires > time.Now().UnixNano() {
+		c.touch(item)
+	}
+	return item
+}
+
+// Records a get of the item, like Cache.touch
+func (c *HierarchicalCache[T]) touch(item *Item[T]) {
+	if c.visitedBit {
+		item.visit()
+		return
+	}
+	select {
+	case c.promotables <- item:
+	default:
+	}
+}
+
+// Same as Get but does not promote the value. This essentially circumvents the
+// "least recently used" aspect of this cache. To some degree, it's akin to a
+// "peak"
+func (c *HierarchicalCache[T]) GetWithoutPromote(path ...string) *Item[T] {
+	if len(path) == 0 {
+		return nil
+	}
+	return c.bucket(path[0]).get(path)
+}
+
+// Iterates through every item whose path starts with prefix (including the
+// item at prefix itself). The path passed to matches must not be modified.
+// Iteration stops if the function returns false. Iteration order is random.
+// An empty prefix iterates through the entire cache.
+func (c *HierarchicalCache[T]) ForEachFunc(prefix []string, matches func(path []string, item *Item[T]) bool) {
+	if len(prefix) > 0 {
+		c.bucket(prefix[0]).forEachFunc(prefix, matches)
+		return
+	}
+	for _, b := range c.buckets {
+		if !b.forEachFunc(prefix, matches) {
+			return
+		}
+	}
+}
+
+// Used when the cache was created with the Track() configuration option.
+// Avoid otherwise
+func (c *HierarchicalCache[T]) TrackingGet(path ...string) TrackedItem[T] {
+	item := c.Get(path...)
+	if item == nil {
+		return nil
+	}
+	item.track()
+	return item
+}
+
+// Used when the cache was created with the Track() configuration option.
+// Sets the item, and returns a tracked reference to it. Returns nil, and
+// doesn't set anything, if path is empty.
+func (c *HierarchicalCache[T]) TrackingSet(path []string, value T, duration time.Duration) TrackedItem[T] {
+	item := c.set(path, value, duration, true)
+	if item == nil {
+		return nil
+	}
+	return item
+}
+
+// Set the value in the cache for the specified duration. Does nothing if
+// path is empty.
+func (c *HierarchicalCache[T]) Set(path []string, value T, duration time.Duration) {
+	c.set(path, value, duration, false)
+}
+
+// Replace the value if it exists, does not set if it doesn't.
+// Returns true if the item existed an was replaced, false otherwise.
+// Replace does not reset item's TTL
+func (c *HierarchicalCache[T]) Replace(path []string, value T) bool {
+	item := c.GetWithoutPromote(path...)
+	if item == nil {
+		return false
+	}
+	c.Set(path, value, item.TTL())
+	return true
+}
+
+// Attempts to get the value from the cache and calles fetch on a miss (missing
+// or stale item). If fetch returns an error, no value is cached and the error
+// is returned back to the caller.
+// Note that Fetch merely calls the public Get and Set functions. If you want
+// a different Fetch behavior, such as thundering herd protection or returning
+// expired items, implement it in your application.
+func (c *HierarchicalCache[T]) Fetch(path []string, duration time.Duration, fetch func() (T, error)) (*Item[T], error) {
+	item := c.Get(path...)
+	if item != nil && !item.Expired() {
+		return item, nil
+	}
+	value, err := fetch()
+	if err != nil {
+		return nil, err
+	}
+	return c.set(path, value, duration, false), nil
+}
+
+// Remove the item at path from the cache, return true if the item was present,
+// false otherwise. Items below path are not removed (see DeleteAll).
+func (c *HierarchicalCache[T]) Delete(path ...string) bool {
+	if len(path) == 0 {
+		return false
+	}
+	item := c.bucket(path[0]).remove(path)
+	if item != nil {
+		c.deletables <- item
+		return true
+	}
+	return false
+}
+
+// Deletes the item at prefix along with every item below it. Returns the number
+// of items deleted. An empty prefix deletes nothing (use Clear).
+func (c *HierarchicalCache[T]) DeleteAll(prefix ...string) int {
+	if len(prefix) == 0 {
+		return 0
+	}
+	return c.bucket(prefix[0]).deleteAll(prefix, c.deletables)
+}
+
+func (c *HierarchicalCache[T]) set(path []string, value T, duration time.Duration, track bool) *Item[T] {
+	if len(path) == 0 {
+		return nil
+	}
+	// we keep the path in the item, it can't change underneath us
+	path = append([]string(nil), path...)
+	item, existing := c.bucket(path[0]).set(path, value, duration, track)
+	if existing != nil {
+		c.deletables <- existing
+	}
+	c.promotables <- item
+	return item
+}
+
+func (c *HierarchicalCache[T]) bucket(key string) *hierarchicalBucket[T] {
+	h := fnv.New32a()
+	h.Write([]byte(key))
+	return c.buckets[h.Sum32()&c.bucketMask]
+}
+
+func (c *HierarchicalCache[T]) halted(fn func()) {
+	c.halt()
+	defer c.unhalt()
+	fn()
+}
+
+func (c *HierarchicalCache[T]) halt() {
+	for _, bucket := range c.buckets {
+		bucket.Lock()
+	}
+}
+
+func (c *HierarchicalCache[T]) unhalt() {
+	for _, bucket := range c.buckets {
+		bucket.Unlock()
+	}
+}
+
+// Handles the control messages which are specific to the HierarchicalCache.
+// Only the worker should call this
+func (c *HierarchicalCache[T]) handle(msg interface{}) {
+	switch msg := msg.(type) {
+	case controlClear:
+		promotables := c.promotables
+		for len(promotables) > 0 {
+			<-promotables
+		}
+		deletables := c.deletables
+		for len(deletables) > 0 {
+			<-deletables
+		}
+
+		c.halted(func() {
+			for _, bucket := range c.buckets {
+				bucket.clear()
+			}
+			c.reset()
+		})
+		msg.done <- struct{}{}
+	}
+}
+
+// Only the Cache has work to do after each message
+func (c *HierarchicalCache[T]) processed() {
+}
+
+func (c *HierarchicalCache[T]) doDelete(item *Item[T]) {
+	if !item.inList {
+		item.promotions = -2
+	} else {
+		c.untrack(item)
+		if c.onDelete != nil {
+			c.onDelete(item)
+		}
+		item.promotions = -2
+	}
+}
+
+func (c *HierarchicalCache[T]) doPromote(item *Item[T]) bool {
+	added, _ := c.track(item)
+	return added
+}
+
+// tracked items that haven't been released can't be evicted
+func (c *HierarchicalCache[T]) evictable(item *Item[T]) bool {
+	return !c.tracking || atomic.LoadInt32(&item.refCount) == 0
+}
+
+// removes the item from the lookup and the policy. Only the worker should call this
+func (c *HierarchicalCache[T]) evict(item *Item[T]) {
+	c.bucket(item.path()[0]).delete(item)
+	c.untrack(item)
+	if c.onDelete != nil {
+		c.onDelete(item)
+	}
+	item.promotions = -2
+}
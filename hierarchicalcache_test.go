@@ -0,0 +1,310 @@
+package ccache
+
+import (
+	"sort"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/karlseguin/ccache/v3/assert"
+)
+
+func Test_HierarchicalCache_GetsANonExistantValue(t *testing.T) {
+	cache := Hierarchical(Configure[string]())
+	defer cache.Stop()
+
+	assert.Equal(t, cache.Get("a", "b", "c"), nil)
+	assert.Equal(t, cache.Get(), nil)
+	assert.Equal(t, cache.ItemCount(), 0)
+}
+
+func Test_HierarchicalCache_SetsValuesAtAnyDepth(t *testing.T) {
+	cache := Hierarchical(Configure[string]())
+	defer cache.Stop()
+
+	cache.Set([]string{"example.com"}, "host", time.Minute)
+	cache.Set([]string{"example.com", "/users/44", ".json"}, "json", time.Minute)
+	cache.Set([]string{"example.com", "/users/44", ".xml"}, "xml", time.Minute)
+	cache.Set([]string{"example.com", "/users/45"}, "user", time.Minute)
+
+	assert.Equal(t, cache.Get("example.com").Value(), "host")
+	assert.Equal(t, cache.Get("example.com", "/users/44", ".json").Value(), "json")
+	assert.Equal(t, cache.Get("example.com", "/users/44", ".xml").Value(), "xml")
+	assert.Equal(t, cache.Get("example.com", "/users/45").Value(), "user")
+	assert.Equal(t, cache.Get("example.com", "/users/44"), nil)
+	assert.Equal(t, cache.Get("example.com", "/users/44", ".json", "x"), nil)
+	assert.Equal(t, cache.ItemCount(), 4)
+
+	item := cache.Get("example.com", "/users/44", ".json")
+	assert.Equal(t, item.Key(), ".json")
+	assert.Equal(t, item.String(), "Item(example.com:/users/44:.json:json)")
+}
+
+func Test_HierarchicalCache_SetCopiesThePath(t *testing.T) {
+	cache := Hierarchical(Configure[string]())
+	defer cache.Stop()
+
+	path := []string{"a", "b"}
+	cache.Set(path, "value", time.Minute)
+	path[1] = "c"
+	assert.Equal(t, cache.Get("a", "b").Value(), "value")
+	cache.Delete("a", "b")
+	cache.SyncUpdates()
+	assert.Equal(t, cache.GetSize(), 0)
+}
+
+func Test_HierarchicalCache_ReplaceAndFetch(t *testing.T) {
+	cache := Hierarchical(Configure[string]())
+	defer cache.Stop()
+
+	assert.Equal(t, cache.Replace([]string{"a", "b"}, "x"), false)
+	assert.Equal(t, cache.Get("a", "b"), nil)
+
+	cache.Set([]string{"a", "b"}, "x", time.Minute)
+	assert.Equal(t, cache.Replace([]string{"a", "b"}, "y"), true)
+	assert.Equal(t, cache.Get("a", "b").Value(), "y")
+
+	item, _ := cache.Fetch([]string{"a", "b"}, time.Minute, func() (string, error) {
+		return "z", nil
+	})
+	assert.Equal(t, item.Value(), "y")
+	item, _ = cache.Fetch([]string{"a", "c"}, time.Minute, func() (string, error) {
+		return "z", nil
+	})
+	assert.Equal(t, item.Value(), "z")
+	assert.Equal(t, cache.Get("a", "c").Value(), "z")
+}
+
+func Test_HierarchicalCache_DeletesALeaf(t *testing.T) {
+	cache := Hierarchical(Configure[string]())
+	defer cache.Stop()
+
+	cache.Set([]string{"a"}, "1", time.Minute)
+	cache.Set([]string{"a", "b"}, "2", time.Minute)
+	cache.Set([]string{"a", "b", "c"}, "3", time.Minute)
+
+	assert.Equal(t, cache.Delete("a", "b"), true)
+	assert.Equal(t, cache.Delete("a", "b"), false)
+	assert.Equal(t, cache.Delete(), false)
+	assert.Equal(t, cache.Get("a", "b"), nil)
+	assert.Equal(t, cache.Get("a").Value(), "1")
+	assert.Equal(t, cache.Get("a", "b", "c").Value(), "3")
+	cache.SyncUpdates()
+	assert.Equal(t, cache.GetSize(), 2)
+}
+
+func Test_HierarchicalCache_DeletesASubtreeAtAnyLevel(t *testing.T) {
+	deleted := int32(0)
+	cache := Hierarchical(Configure[string]().OnDelete(func(item *Item[string]) {
+		atomic.AddInt32(&deleted, 1)
+	}))
+	defer cache.Stop()
+
+	cache.Set([]string{"h1"}, "0", time.Minute)
+	cache.Set([]string{"h1", "/a", ".json"}, "1", time.Minute)
+	cache.Set([]string{"h1", "/a", ".xml"}, "2", time.Minute)
+	cache.Set([]string{"h1", "/b", ".json"}, "3", time.Minute)
+	cache.Set([]string{"h2", "/a", ".json"}, "4", time.Minute)
+	cache.SyncUpdates()
+
+	assert.Equal(t, cache.DeleteAll("h1", "/nope"), 0)
+	assert.Equal(t, cache.DeleteAll(), 0)
+
+	assert.Equal(t, cache.DeleteAll("h1", "/a"), 2)
+	assert.Equal(t, cache.Get("h1", "/a", ".json"), nil)
+	assert.Equal(t, cache.Get("h1", "/b", ".json").Value(), "3")
+
+	assert.Equal(t, cache.DeleteAll("h1"), 2)
+	assert.Equal(t, cache.Get("h1"), nil)
+	assert.Equal(t, cache.Get("h1", "/b", ".json"), nil)
+	assert.Equal(t, cache.Get("h2", "/a", ".json").Value(), "4")
+
+	cache.SyncUpdates()
+	assert.Equal(t, cache.GetSize(), 1)
+	assert.Equal(t, atomic.LoadInt32(&deleted), 4)
+
+	// empty nodes are removed
+	_, exists := cache.bucket("h1").root.children["h1"]
+	assert.False(t, exists)
+}
+
+func Test_HierarchicalCache_RemovesEmptyNodes(t *testing.T) {
+	cache := Hierarchical(Configure[string]())
+	defer cache.Stop()
+
+	cache.Set([]string{"a", "b", "c"}, "1", time.Minute)
+	cache.Set([]string{"a", "x"}, "2", time.Minute)
+	cache.Delete("a", "b", "c")
+	b := cache.bucket("a")
+	assert.Equal(t, len(b.root.children["a"].children), 1)
+	cache.Delete("a", "x")
+	assert.Equal(t, len(b.root.children), 0)
+}
+
+func Test_HierarchicalCache_ForEachFunc(t *testing.T) {
+	cache := Hierarchical(Configure[string]())
+	defer cache.Stop()
+
+	cache.Set([]string{"a"}, "1", time.Minute)
+	cache.Set([]string{"a", "b"}, "2", time.Minute)
+	cache.Set([]string{"a", "b", "c"}, "3", time.Minute)
+	cache.Set([]string{"z", "y"}, "4", time.Minute)
+
+	assert.List(t, forEachPaths(cache, "a", "b"), []string{"a/b", "a/b/c"})
+	assert.List(t, forEachPaths(cache, "a"), []string{"a", "a/b", "a/b/c"})
+	assert.List(t, forEachPaths(cache), []string{"a", "a/b", "a/b/c", "z/y"})
+	assert.List(t, forEachPaths(cache, "nope"), []string{})
+}
+
+func Test_HierarchicalCache_GCsTheOldestItems(t *testing.T) {
+	cache := Hierarchical(Configure[int]().MaxSize(100).PercentToPrune(10))
+	defer cache.Stop()
+
+	for i := 0; i < 100; i++ {
+		cache.Set([]string{"a", strconv.Itoa(i), "x"}, i, time.Minute)
+	}
+	cache.SyncUpdates()
+	cache.GC()
+	assert.Equal(t, cache.Get("a", "9", "x"), nil)
+	assert.Equal(t, cache.Get("a", "10", "x").Value(), 10)
+	assert.Equal(t, cache.ItemCount(), 90)
+	assert.Equal(t, len(cache.bucket("a").root.children["a"].children), 90)
+}
+
+func Test_HierarchicalCache_PromotedItemsDontGetPruned(t *testing.T) {
+	cache := Hierarchical(Configure[int]().MaxSize(100).PercentToPrune(10).GetsPerPromote(1))
+	defer cache.Stop()
+
+	for i := 0; i < 100; i++ {
+		cache.Set([]string{strconv.Itoa(i), "a"}, i, time.Minute)
+	}
+	cache.SyncUpdates()
+	cache.Get("9", "a")
+	cache.SyncUpdates()
+	cache.GC()
+	assert.Equal(t, cache.Get("9", "a").Value(), 9)
+	assert.Equal(t, cache.Get("10", "a"), nil)
+	assert.Equal(t, cache.Get("11", "a").Value(), 11)
+}
+
+func Test_HierarchicalCache_TrackerDoesNotCleanupHeldInstance(t *testing.T) {
+	cache := Hierarchical(Configure[int]().MaxSize(10).PercentToPrune(10).Track())
+	defer cache.Stop()
+
+	item0 := cache.TrackingSet([]string{"0", "a"}, 0, time.Minute)
+	for i := 1; i < 11; i++ {
+		cache.Set([]string{strconv.Itoa(i), "a"}, i, time.Minute)
+	}
+	cache.SyncUpdates()
+	cache.GC()
+	assert.Equal(t, cache.Get("0", "a").Value(), 0)
+	assert.Equal(t, cache.Get("1", "a"), nil)
+	item0.Release()
+	for i := 20; i < 22; i++ {
+		cache.Set([]string{strconv.Itoa(i), "a"}, i, time.Minute)
+	}
+	cache.SyncUpdates()
+	cache.GC()
+	assert.Equal(t, cache.Get("0", "a"), nil)
+}
+
+func Test_HierarchicalCache_SetUpdatesSizeOnDelta(t *testing.T) {
+	cache := Hierarchical(Configure[*SizedItem]())
+	defer cache.Stop()
+
+	cache.Set([]string{"a", "b"}, &SizedItem{0, 2}, time.Minute)
+	cache.Set([]string{"a"}, &SizedItem{0, 3}, time.Minute)
+	cache.SyncUpdates()
+	assert.Equal(t, cache.GetSize(), 5)
+	cache.Set([]string{"a"}, &SizedItem{0, 4}, time.Minute)
+	cache.SyncUpdates()
+	assert.Equal(t, cache.GetSize(), 6)
+	cache.Clear()
+	assert.Equal(t, cache.GetSize(), 0)
+	assert.Equal(t, cache.ItemCount(), 0)
+}
+
+func Test_HierarchicalCache_SieveAndClock(t *testing.T) {
+	for _, config := range []*Configuration[int]{Configure[int]().Sieve(), Configure[int]().Clock()} {
+		cache := Hierarchical(config.MaxSize(5).PercentToPrune(1))
+		for i := 0; i < 5; i++ {
+			cache.Set([]string{"a", strconv.Itoa(i)}, i, time.Minute)
+		}
+		cache.SyncUpdates()
+		assert.Equal(t, cache.Get("a", "0").Value(), 0)
+
+		for i := 5; i < 10; i++ {
+			cache.Set([]string{"a", strconv.Itoa(i)}, i, time.Minute)
+			cache.SyncUpdates()
+		}
+		assert.Equal(t, cache.ItemCount(), 5)
+		assert.Equal(t, cache.Get("a", "0").Value(), 0)
+		for i := 1; i < 6; i++ {
+			assert.Equal(t, cache.Get("a", strconv.Itoa(i)), nil)
+		}
+		cache.Stop()
+	}
+}
+
+func Test_HierarchicalCache_ARCKeysIncludeThePath(t *testing.T) {
+	a := newItem("x", 0, 0, false)
+	a.extend().path = []string{"a", "x"}
+	b := newItem("x", 0, 0, false)
+	b.extend().path = []string{"b", "x"}
+	assert.Equal(t, newARCKey(a) == newARCKey(b), false)
+	assert.Equal(t, newARCKey(a) == newARCKey(a), true)
+}
+
+func Test_HierarchicalCache_CountsItems(t *testing.T) {
+	cache := Hierarchical(Configure[int]().MaxSize(5).PercentToPrune(20))
+	defer cache.Stop()
+
+	cache.Set([]string{"a"}, 1, time.Minute)
+	cache.Set([]string{"a", "b"}, 2, time.Minute)
+	cache.Set([]string{"a", "b", "c"}, 3, time.Minute)
+	cache.Set([]string{"a", "b"}, 4, time.Minute)
+	assert.Equal(t, cache.ItemCount(), 3)
+
+	cache.Delete("a", "b")
+	cache.Delete("a", "b")
+	assert.Equal(t, cache.ItemCount(), 2)
+
+	assert.Equal(t, cache.DeleteAll("a"), 2)
+	assert.Equal(t, cache.ItemCount(), 0)
+	cache.SyncUpdates()
+
+	for i := 0; i < 6; i++ {
+		cache.Set([]string{"b", strconv.Itoa(i)}, i, time.Minute)
+	}
+	// the 6th item takes the cache over its max size, it's pruned to 80%
+	cache.SyncUpdates()
+	assert.Equal(t, cache.ItemCount(), 4)
+}
+
+func Test_HierarchicalCache_IgnoresAnEmptyPath(t *testing.T) {
+	cache := Hierarchical(Configure[string]().Track())
+	defer cache.Stop()
+
+	cache.Set(nil, "value", time.Minute)
+	assert.Equal(t, cache.TrackingSet([]string{}, "value", time.Minute) == nil, true)
+	item, err := cache.Fetch(nil, time.Minute, func() (string, error) {
+		return "value", nil
+	})
+	assert.Nil(t, err)
+	assert.Equal(t, item, nil)
+	cache.SyncUpdates()
+	assert.Equal(t, cache.ItemCount(), 0)
+	assert.Equal(t, cache.GetSize(), 0)
+}
+
+func forEachPaths[T any](cache *HierarchicalCache[T], prefix ...string) []string {
+	paths := make([]string, 0, 10)
+	cache.ForEachFunc(prefix, func(path []string, item *Item[T]) bool {
+		paths = append(paths, strings.Join(path, "/"))
+		return true
+	})
+	sort.Strings(paths)
+	return paths
+}
@@ -0,0 +1,225 @@
+package ccache
+
+import (
+	"container/heap"
+	"hash/fnv"
+	"sort"
+)
+
+const (
+	// rows of the count-min sketch
+	sketchDepth = 4
+
+	// the narrowest the count-min sketch gets
+	sketchMinWidth = 1024
+)
+
+// A key returned by TopKeys, with its (approximate) number of accesses
+type HotKey struct {
+	// The primary key of a LayeredCache's key (empty for a Cache)
+	Group string
+	Key   string
+	Count int64
+}
+
+// Finds the most accessed keys (see Configuration.TrackHotKeys). Accesses are
+// counted in a count-min sketch, and the keys with the highest counts are
+// kept in a min-heap. To approximate a sliding window of window accesses,
+// there are two sketches: every window/2 accesses, the current sketch becomes
+// the previous one, and the oldest one is dropped. A key's count is its count
+// in both. Only the worker uses this.
+type hotKeys struct {
+	capacity int
+	window   int
+	accesses int
+	current  *countMinSketch
+	previous *countMinSketch
+	keys     []*HotKey
+	index    map[hotKeyID]int
+}
+
+type hotKeyID struct {
+	group string
+	key   string
+}
+
+func (k *HotKey) id() hotKeyID {
+	return hotKeyID{k.Group, k.Key}
+}
+
+func newHotKeys(capacity int, window int) *hotKeys {
+	if window < 2 {
+		window = 2
+	}
+	width := uint64(sketchMinWidth)
+	for width < uint64(capacity)*16 {
+		width *= 2
+	}
+	return &hotKeys{
+		capacity: capacity,
+		window:   window,
+		current:  newCountMinSketch(width),
+		previous: newCountMinSketch(width),
+		index:    make(map[hotKeyID]int),
+	}
+}
+
+func (h *hotKeys) record(group string, key string) {
+	hash := hotKeyHash(group, key)
+	count := h.current.add(hash) + h.previous.estimate(hash)
+
+	if i, ok := h.index[hotKeyID{group, key}]; ok {
+		h.keys[i].Count = count
+		heap.Fix(h, i)
+	} else if len(h.keys) < h.capacity {
+		heap.Push(h, &HotKey{Group: group, Key: key, Count: count})
+	} else if len(h.keys) > 0 && count > h.keys[0].Count {
+		// replaces the key with the lowest count
+		k := h.keys[0]
+		delete(h.index, k.id())
+		k.Group, k.Key, k.Count = group, key, count
+		h.index[k.id()] = 0
+		heap.Fix(h, 0)
+	}
+
+	h.accesses += 1
+	if h.accesses >= h.window/2 {
+		h.rotate()
+	}
+}
+
+// Drops the oldest half of the window. The tracked keys' counts are now only
+// what they were in the newest half.
+func (h *hotKeys) rotate() {
+	h.previous, h.current = h.current, h.previous
+	h.current.reset()
+	h.accesses = 0
+
+	keys := h.keys[:0]
+	for _, k := range h.keys {
+		delete(h.index, k.id())
+		if k.Count = h.previous.estimate(hotKeyHash(k.Group, k.Key)); k.Count > 0 {
+			keys = append(keys, k)
+		}
+	}
+	for i := len(keys); i < len(h.keys); i++ {
+		h.keys[i] = nil
+	}
+	h.keys = keys
+	for i, k := range keys {
+		h.index[k.id()] = i
+	}
+	heap.Init(h)
+}
+
+// The n keys with the highest counts, highest first
+func (h *hotKeys) top(n int) []HotKey {
+	if n <= 0 {
+		return []HotKey{}
+	}
+	keys := make([]HotKey, len(h.keys))
+	for i, k := range h.keys {
+		keys[i] = *k
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		return keys[i].Count > keys[j].Count
+	})
+	if n < len(keys) {
+		keys = keys[:n]
+	}
+	return keys
+}
+
+func (h *hotKeys) Len() int {
+	return len(h.keys)
+}
+
+func (h *hotKeys) Less(i, j int) bool {
+	return h.keys[i].Count < h.keys[j].Count
+}
+
+func (h *hotKeys) Swap(i, j int) {
+	keys := h.keys
+	keys[i], keys[j] = keys[j], keys[i]
+	h.index[keys[i].id()] = i
+	h.index[keys[j].id()] = j
+}
+
+func (h *hotKeys) Push(x interface{}) {
+	k := x.(*HotKey)
+	h.index[k.id()] = len(h.keys)
+	h.keys = append(h.keys, k)
+}
+
+func (h *hotKeys) Pop() interface{} {
+	keys := h.keys
+	l := len(keys) - 1
+	k := keys[l]
+	keys[l] = nil
+	delete(h.index, k.id())
+	h.keys = keys[:l]
+	return k
+}
+
+func hotKeyHash(group string, key string) uint64 {
+	h := fnv.New64a()
+	h.Write([]byte(group))
+	h.Write([]byte{0})
+	h.Write([]byte(key))
+	return h.Sum64()
+}
+
+// A count-min sketch: every row counts the hashes modulo its width (each row
+// hashing differently). A hash's count is its smallest count across rows,
+// which can only overestimate.
+type countMinSketch struct {
+	mask uint64
+	rows [sketchDepth][]uint32
+}
+
+// width must be a power of 2
+func newCountMinSketch(width uint64) *countMinSketch {
+	s := &countMinSketch{mask: width - 1}
+	for i := range s.rows {
+		s.rows[i] = make([]uint32, width)
+	}
+	return s
+}
+
+// Adds one to the hash's count, and returns its new estimate
+func (s *countMinSketch) add(hash uint64) int64 {
+	estimate := int64(-1)
+	for i, row := range s.rows {
+		j := s.column(hash, i)
+		if row[j] < ^uint32(0) {
+			row[j] += 1
+		}
+		if n := int64(row[j]); estimate == -1 || n < estimate {
+			estimate = n
+		}
+	}
+	return estimate
+}
+
+func (s *countMinSketch) estimate(hash uint64) int64 {
+	estimate := int64(-1)
+	for i, row := range s.rows {
+		if n := int64(row[s.column(hash, i)]); estimate == -1 || n < estimate {
+			estimate = n
+		}
+	}
+	return estimate
+}
+
+// Rows are indexed by double hashing: h1 + i*h2 (h2 being odd, so that the
+// rows differ)
+func (s *countMinSketch) column(hash uint64, row int) uint64 {
+	h1, h2 := hash, (hash>>32|hash<<32)|1
+	return (h1 + uint64(row)*h2) & s.mask
+}
+
+func (s *countMinSketch) reset() {
+	for _, row := range s.rows {
+		clear(row)
+	}
+}
@@ -0,0 +1,100 @@
+package ccache
+
+import (
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/karlseguin/ccache/v3/assert"
+)
+
+func Test_CountMinSketch(t *testing.T) {
+	s := newCountMinSketch(1024)
+	a, b := hotKeyHash("", "a"), hotKeyHash("", "b")
+	for i := 0; i < 5; i++ {
+		s.add(a)
+	}
+	assert.Equal(t, s.add(b), 1)
+	assert.Equal(t, s.estimate(a), 5)
+	assert.Equal(t, s.estimate(b), 1)
+	assert.Equal(t, s.estimate(hotKeyHash("", "c")), 0)
+	s.reset()
+	assert.Equal(t, s.estimate(a), 0)
+}
+
+func Test_HotKeys_KeepsTheMostAccessedKeys(t *testing.T) {
+	h := newHotKeys(2, 1000)
+	for i := 0; i < 10; i++ {
+		for j := 0; j <= i; j++ {
+			h.record("", strconv.Itoa(i))
+		}
+	}
+	assert.Equal(t, len(h.index), 2)
+	top := h.top(5)
+	assert.Equal(t, len(top), 2)
+	assert.Equal(t, top[0], HotKey{Key: "9", Count: 10})
+	assert.Equal(t, top[1], HotKey{Key: "8", Count: 9})
+	assert.Equal(t, h.top(1)[0].Key, "9")
+	assert.Equal(t, len(h.top(0)), 0)
+	assert.Equal(t, len(h.top(-1)), 0)
+}
+
+func Test_HotKeys_SlidingWindow(t *testing.T) {
+	h := newHotKeys(5, 20)
+	for i := 0; i < 10; i++ {
+		h.record("", "old")
+	}
+	// the window rotated, old's 10 accesses are now in the previous half
+	assert.Equal(t, h.top(1)[0], HotKey{Key: "old", Count: 10})
+
+	for i := 0; i < 9; i++ {
+		h.record("g", "new")
+	}
+	assert.Equal(t, h.top(1)[0], HotKey{Key: "old", Count: 10})
+	h.record("g", "new")
+
+	// and now they're gone
+	top := h.top(5)
+	assert.Equal(t, len(top), 1)
+	assert.Equal(t, top[0], HotKey{Group: "g", Key: "new", Count: 10})
+}
+
+func Test_CacheTopKeys(t *testing.T) {
+	cache := New(Configure[int]().TrackHotKeys(10, 1000))
+	defer cache.Stop()
+
+	cache.Set("hot", 1, time.Minute)
+	cache.Set("cold", 2, time.Minute)
+	cache.SyncUpdates()
+	for i := 0; i < 5; i++ {
+		cache.Get("hot")
+		cache.SyncUpdates()
+	}
+	top := cache.TopKeys(1)
+	assert.Equal(t, len(top), 1)
+	assert.Equal(t, top[0], HotKey{Key: "hot", Count: 6})
+	assert.Equal(t, len(cache.TopKeys(10)), 2)
+}
+
+func Test_CacheTopKeysWhenNotTracked(t *testing.T) {
+	cache := New(Configure[int]())
+	defer cache.Stop()
+	assert.Nil(t, cache.TopKeys(10))
+}
+
+func Test_LayeredCacheTopKeys(t *testing.T) {
+	cache := Layered(Configure[int]().TrackHotKeys(10, 1000))
+	defer cache.Stop()
+
+	cache.Set("a", "hot", 1, time.Minute)
+	cache.Set("b", "hot", 2, time.Minute)
+	cache.SyncUpdates()
+	for i := 0; i < 3; i++ {
+		cache.Get("b", "hot")
+		cache.SyncUpdates()
+	}
+	top := cache.TopKeys(2)
+	assert.Equal(t, len(top), 2)
+	assert.Equal(t, top[0], HotKey{Group: "b", Key: "hot", Count: 4})
+	assert.Equal(t, top[1], HotKey{Group: "a", Key: "hot", Count: 1})
+}
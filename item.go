@@ -2,6 +2,7 @@ package ccache
 
 import (
 	"fmt"
+	"strings"
 	"sync/atomic"
 	"time"
 )
@@ -30,6 +31,61 @@ type Item[T any] struct {
 	next       *Item[T]
 	prev       *Item[T]
 	inList     bool
+	priority   Priority
+
+	// itemVisited and itemPinned, changed atomically
+	flags uint32
+
+	// what only some items, or only some features, need. Both are nil until
+	// they are (see extend and workerState)
+	ext   *itemExt
+	state *itemState[T]
+}
+
+const (
+	// set by gets when using SIEVE or CLOCK, cleared by the worker
+	itemVisited uint32 = 1 << iota
+
+	// only the worker changes this
+	itemPinned
+)
+
+// The item's optional attributes. They're set before the item is stored, and
+// never changed after, so they can be read without synchronization.
+type itemExt struct {
+	// the HierarchicalCache's key
+	path []string
+
+	// the tags the item was set with (via SetWithTags)
+	tags []string
+
+	// the keys this item depends on (via SetWithDependencies)
+	dependencies []string
+
+	// how long the item takes to recompute, in nanoseconds (see SetWithCost)
+	cost int64
+
+	// the generation of the bucket, and of the LayeredCache, at the time the
+	// item was set (only used by the LayeredCache's generational mode)
+	generation      uint64
+	cacheGeneration uint64
+}
+
+// What the worker's optional structures track about the item. Only the worker
+// touches it.
+type itemState[T any] struct {
+	// used by the eviction policies other than the default one
+	policyIndex int
+	frequency   uint32
+	score       float64
+
+	// the LayeredCache's per-group list (only used with group quotas)
+	groupNext *Item[T]
+	groupPrev *Item[T]
+
+	// position in, and expiry as known by, the expiries heap
+	expiryIndex    int
+	indexedExpires int64
 }
 
 func newItem[T any](key string, value T, expires int64, track bool) *Item[T] {
@@ -53,6 +109,74 @@ func newItem[T any](key string, value T, expires int64, track bool) *Item[T] {
 	return item
 }
 
+// The item's optional attributes, allocated on first use. Must only be called
+// before the item is stored.
+func (i *Item[T]) extend() *itemExt {
+	if i.ext == nil {
+		i.ext = &itemExt{}
+	}
+	return i.ext
+}
+
+// The worker's state for the item, allocated on first use. Must only be
+// called by the worker.
+func (i *Item[T]) workerState() *itemState[T] {
+	if i.state == nil {
+		i.state = &itemState[T]{policyIndex: -1, expiryIndex: -1}
+	}
+	return i.state
+}
+
+func (i *Item[T]) path() []string {
+	if i.ext == nil {
+		return nil
+	}
+	return i.ext.path
+}
+
+func (i *Item[T]) dependencies() []string {
+	if i.ext == nil {
+		return nil
+	}
+	return i.ext.dependencies
+}
+
+func (i *Item[T]) generation() uint64 {
+	if i.ext == nil {
+		return 0
+	}
+	return i.ext.generation
+}
+
+func (i *Item[T]) cacheGeneration() uint64 {
+	if i.ext == nil {
+		return 0
+	}
+	return i.ext.cacheGeneration
+}
+
+func (i *Item[T]) visit() {
+	if atomic.LoadUint32(&i.flags)&itemVisited == 0 {
+		atomic.OrUint32(&i.flags, itemVisited)
+	}
+}
+
+func (i *Item[T]) visited() bool {
+	return atomic.LoadUint32(&i.flags)&itemVisited != 0
+}
+
+func (i *Item[T]) unvisit() {
+	atomic.AndUint32(&i.flags, ^itemVisited)
+}
+
+func (i *Item[T]) setPinned(pinned bool) {
+	if pinned {
+		atomic.OrUint32(&i.flags, itemPinned)
+	} else {
+		atomic.AndUint32(&i.flags, ^itemPinned)
+	}
+}
+
 func (i *Item[T]) shouldPromote(getsPerPromote int32) bool {
 	i.promotions += 1
 	return i.promotions == getsPerPromote
@@ -62,6 +186,37 @@ func (i *Item[T]) Key() string {
 	return i.key
 }
 
+// The priority the item was set with (see Cache.SetWithPriority)
+func (i *Item[T]) Priority() Priority {
+	return i.priority
+}
+
+// How long the item takes to recompute (see Cache.SetWithCost)
+func (i *Item[T]) Cost() time.Duration {
+	if i.ext == nil {
+		return 0
+	}
+	return time.Duration(i.ext.cost)
+}
+
+// Whether the item is pinned (see Cache.Pin)
+func (i *Item[T]) Pinned() bool {
+	return atomic.LoadUint32(&i.flags)&itemPinned != 0
+}
+
+// The primary key of a LayeredCache's item (empty for other caches)
+func (i *Item[T]) Group() string {
+	return i.group
+}
+
+// The tags the item was set with (via SetWithTags), if any
+func (i *Item[T]) Tags() []string {
+	if i.ext == nil {
+		return nil
+	}
+	return i.ext.tags
+}
+
 func (i *Item[T]) Value() T {
 	return i.value
 }
@@ -100,6 +255,9 @@ func (i *Item[T]) Extend(duration time.Duration) {
 // fmt.Sprintf expression could cause fields of the Item to be read in a non-thread-safe
 // way.
 func (i *Item[T]) String() string {
+	if path := i.path(); path != nil {
+		return fmt.Sprintf("Item(%s:%v)", strings.Join(path, ":"), i.value)
+	}
 	group := i.group
 	if group == "" {
 		return fmt.Sprintf("Item(%s:%v)", i.key, i.value)
@@ -4,6 +4,7 @@ import (
 	"math"
 	"testing"
 	"time"
+	"unsafe"
 
 	"github.com/karlseguin/ccache/v3/assert"
 )
@@ -13,6 +14,14 @@ func Test_Item_Key(t *testing.T) {
 	assert.Equal(t, item.Key(), "foo")
 }
 
+// Features keep their per-item state out of Item, see itemExt and itemState
+func Test_Item_Size(t *testing.T) {
+	if unsafe.Sizeof(uintptr(0)) != 8 {
+		t.Skip("only checked on 64-bit platforms")
+	}
+	assert.Equal(t, unsafe.Sizeof(Item[int]{}), 104)
+}
+
 func Test_Item_Promotability(t *testing.T) {
 	item := &Item[int]{promotions: 4}
 	assert.Equal(t, item.shouldPromote(5), true)
@@ -0,0 +1,262 @@
+package ccache
+
+import (
+	"strings"
+	"sync"
+)
+
+// An ordered index of every key in the cache, enabled with the PrefixIndex()
+// option. It's a radix tree, so finding the keys with a given prefix costs the
+// length of the prefix plus the number of matching keys, rather than a scan of
+// every key. Like the tag index, it's a bucket observer: it's updated under the
+// bucket's write lock and always mirrors the buckets' lookups.
+type keyIndex[T any] struct {
+	sync.RWMutex
+	root *radixNode[T]
+}
+
+// A node's prefix is the part of the key between its parent and itself. Its
+// children are sorted by the first byte of their prefix (which is unique among
+// siblings), so walking the tree visits keys in lexical order. count is the
+// number of items in the node's subtree, including its own.
+type radixNode[T any] struct {
+	prefix   string
+	item     *Item[T]
+	children []*radixNode[T]
+	count    int
+}
+
+func newKeyIndex[T any]() *keyIndex[T] {
+	return &keyIndex[T]{root: &radixNode[T]{}}
+}
+
+func (k *keyIndex[T]) added(item *Item[T]) {
+	k.Lock()
+	k.root.insert(item.key, item)
+	k.Unlock()
+}
+
+func (k *keyIndex[T]) removed(item *Item[T]) {
+	k.Lock()
+	k.root.remove(item.key, item)
+	k.Unlock()
+}
+
+// A snapshot of the items whose key starts with prefix, in key order
+func (k *keyIndex[T]) prefixed(prefix string) []*Item[T] {
+	k.RLock()
+	defer k.RUnlock()
+	node := k.root.find(prefix)
+	if node == nil {
+		return nil
+	}
+	items := make([]*Item[T], 0, node.count)
+	node.walk(func(item *Item[T]) bool {
+		items = append(items, item)
+		return true
+	})
+	return items
+}
+
+func (k *keyIndex[T]) countPrefix(prefix string) int {
+	k.RLock()
+	defer k.RUnlock()
+	node := k.root.find(prefix)
+	if node == nil {
+		return 0
+	}
+	return node.count
+}
+
+// A snapshot of the items whose key is >= from and < to (without an upper
+// bound when to is ""), in key order. At most limit items are returned, unless
+// limit is <= 0.
+func (k *keyIndex[T]) between(from string, to string, limit int) []*Item[T] {
+	k.RLock()
+	defer k.RUnlock()
+	var items []*Item[T]
+	k.root.walkFrom(from, func(item *Item[T]) bool {
+		if to != "" && item.key >= to {
+			return false
+		}
+		items = append(items, item)
+		return limit <= 0 || len(items) < limit
+	})
+	return items
+}
+
+// Returns true if the item was added (as opposed to replacing an existing one)
+func (n *radixNode[T]) insert(key string, item *Item[T]) bool {
+	if key == "" {
+		added := n.item == nil
+		n.item = item
+		if added {
+			n.count += 1
+		}
+		return added
+	}
+
+	i, found := n.childIndex(key[0])
+	if !found {
+		child := &radixNode[T]{prefix: key, item: item, count: 1}
+		n.children = append(n.children, nil)
+		copy(n.children[i+1:], n.children[i:])
+		n.children[i] = child
+		n.count += 1
+		return true
+	}
+
+	child := n.children[i]
+	common := commonPrefixLength(child.prefix, key)
+	if common < len(child.prefix) {
+		// split the child's prefix, the new node takes the child's place
+		split := &radixNode[T]{
+			prefix:   child.prefix[:common],
+			children: []*radixNode[T]{child},
+			count:    child.count,
+		}
+		child.prefix = child.prefix[common:]
+		n.children[i] = split
+		child = split
+	}
+
+	added := child.insert(key[common:], item)
+	if added {
+		n.count += 1
+	}
+	return added
+}
+
+// Only removes the item if it's the one stored at key. Returns true if it was
+// removed.
+func (n *radixNode[T]) remove(key string, item *Item[T]) bool {
+	if key == "" {
+		if n.item != item {
+			return false
+		}
+		n.item = nil
+		n.count -= 1
+		return true
+	}
+
+	i, found := n.childIndex(key[0])
+	if !found {
+		return false
+	}
+	child := n.children[i]
+	if !strings.HasPrefix(key, child.prefix) || !child.remove(key[len(child.prefix):], item) {
+		return false
+	}
+	n.count -= 1
+
+	if child.item == nil {
+		switch len(child.children) {
+		case 0:
+			n.children = append(n.children[:i], n.children[i+1:]...)
+		case 1:
+			// merge the child with its only child
+			grandchild := child.children[0]
+			grandchild.prefix = child.prefix + grandchild.prefix
+			n.children[i] = grandchild
+		}
+	}
+	return true
+}
+
+// Returns the node whose subtree contains exactly the keys starting with
+// prefix, or nil if there are none.
+func (n *radixNode[T]) find(prefix string) *radixNode[T] {
+	node := n
+	for prefix != "" {
+		i, found := node.childIndex(prefix[0])
+		if !found {
+			return nil
+		}
+		child := node.children[i]
+		if strings.HasPrefix(child.prefix, prefix) {
+			return child
+		}
+		if !strings.HasPrefix(prefix, child.prefix) {
+			return nil
+		}
+		prefix = prefix[len(child.prefix):]
+		node = child
+	}
+	return node
+}
+
+// Visits the subtree's items in key order
+func (n *radixNode[T]) walk(fn func(item *Item[T]) bool) bool {
+	if n.item != nil && !fn(n.item) {
+		return false
+	}
+	for _, child := range n.children {
+		if !child.walk(fn) {
+			return false
+		}
+	}
+	return true
+}
+
+// Like walk, but skips items whose key (relative to n) is less than from
+func (n *radixNode[T]) walkFrom(from string, fn func(item *Item[T]) bool) bool {
+	if from == "" {
+		return n.walk(fn)
+	}
+	// n's own item, if any, is less than from, skip it
+
+	i, found := n.childIndex(from[0])
+	if found {
+		child := n.children[i]
+		prefix := child.prefix
+		if len(prefix) < len(from) {
+			if prefix == from[:len(prefix)] {
+				if !child.walkFrom(from[len(prefix):], fn) {
+					return false
+				}
+			} else if prefix > from && !child.walk(fn) {
+				return false
+			}
+		} else if prefix >= from && !child.walk(fn) {
+			return false
+		}
+		i += 1
+	}
+
+	// every remaining child starts with a byte greater than from's
+	for _, child := range n.children[i:] {
+		if !child.walk(fn) {
+			return false
+		}
+	}
+	return true
+}
+
+// Binary search for the child whose prefix starts with b. If there's no such
+// child, returns the index at which it would be inserted.
+func (n *radixNode[T]) childIndex(b byte) (int, bool) {
+	children := n.children
+	lo, hi := 0, len(children)
+	for lo < hi {
+		mid := (lo + hi) / 2
+		if children[mid].prefix[0] < b {
+			lo = mid + 1
+		} else {
+			hi = mid
+		}
+	}
+	return lo, lo < len(children) && children[lo].prefix[0] == b
+}
+
+func commonPrefixLength(a string, b string) int {
+	l := len(a)
+	if len(b) < l {
+		l = len(b)
+	}
+	for i := 0; i < l; i++ {
+		if a[i] != b[i] {
+			return i
+		}
+	}
+	return l
+}
@@ -0,0 +1,129 @@
+package ccache
+
+import (
+	"math/rand"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/karlseguin/ccache/v3/assert"
+)
+
+func Test_KeyIndex_Prefixed(t *testing.T) {
+	index := newKeyIndex[int]()
+	for _, key := range []string{"romane", "romanus", "romulus", "rubens", "ruber", "rubicon", "rubicundus", "r", ""} {
+		index.added(newItem(key, 0, 0, false))
+	}
+
+	assert.List(t, keyIndexKeys(index, "rom"), []string{"romane", "romanus", "romulus"})
+	assert.List(t, keyIndexKeys(index, "rub"), []string{"rubens", "ruber", "rubicon", "rubicundus"})
+	assert.List(t, keyIndexKeys(index, "rube"), []string{"rubens", "ruber"})
+	assert.List(t, keyIndexKeys(index, "ruber"), []string{"ruber"})
+	assert.List(t, keyIndexKeys(index, "rubers"), []string{})
+	assert.List(t, keyIndexKeys(index, "x"), []string{})
+	assert.Equal(t, index.countPrefix("r"), 8)
+	assert.Equal(t, index.countPrefix(""), 9)
+	assert.Equal(t, index.countPrefix("ro"), 3)
+	assert.Equal(t, index.countPrefix("romanes"), 0)
+}
+
+func Test_KeyIndex_OnlyRemovesTheSameItem(t *testing.T) {
+	index := newKeyIndex[int]()
+	old := newItem("a", 1, 0, false)
+	index.added(old)
+	index.added(newItem("a", 2, 0, false))
+	assert.Equal(t, index.countPrefix(""), 1)
+
+	index.removed(old)
+	assert.Equal(t, index.countPrefix(""), 1)
+	assert.Equal(t, index.prefixed("a")[0].Value(), 2)
+}
+
+func Test_KeyIndex_MatchesBruteForce(t *testing.T) {
+	index := newKeyIndex[int]()
+	items := make(map[string]*Item[int])
+	alphabet := "abc"
+	randomKey := func() string {
+		b := make([]byte, rand.Intn(6))
+		for i := range b {
+			b[i] = alphabet[rand.Intn(len(alphabet))]
+		}
+		return string(b)
+	}
+
+	for i := 0; i < 5000; i++ {
+		key := randomKey()
+		if existing, ok := items[key]; ok && rand.Intn(2) == 0 {
+			index.removed(existing)
+			delete(items, key)
+		} else {
+			item := newItem(key, i, 0, false)
+			index.added(item)
+			items[key] = item
+		}
+
+		prefix := randomKey()
+		var expected []string
+		for key := range items {
+			if strings.HasPrefix(key, prefix) {
+				expected = append(expected, key)
+			}
+		}
+		sort.Strings(expected)
+		if expected == nil {
+			expected = []string{}
+		}
+		assert.List(t, keyIndexKeys(index, prefix), expected)
+		assert.Equal(t, index.countPrefix(prefix), len(expected))
+
+		from, to := randomKey(), randomKey()
+		expected = expected[:0]
+		for key := range items {
+			if key >= from && (to == "" || key < to) {
+				expected = append(expected, key)
+			}
+		}
+		sort.Strings(expected)
+		actual := make([]string, 0)
+		for _, item := range index.between(from, to, 0) {
+			actual = append(actual, item.key)
+		}
+		assert.List(t, actual, expected)
+	}
+
+	for _, item := range items {
+		index.removed(item)
+	}
+	assert.Equal(t, index.countPrefix(""), 0)
+	assert.Equal(t, len(index.root.children), 0)
+}
+
+func Test_KeyIndex_Between(t *testing.T) {
+	index := newKeyIndex[int]()
+	for _, key := range []string{"a", "ab", "abc", "abd", "b", "ba", "c"} {
+		index.added(newItem(key, 0, 0, false))
+	}
+
+	between := func(from string, to string, limit int) []string {
+		keys := make([]string, 0)
+		for _, item := range index.between(from, to, limit) {
+			keys = append(keys, item.key)
+		}
+		return keys
+	}
+	assert.List(t, between("", "", 0), []string{"a", "ab", "abc", "abd", "b", "ba", "c"})
+	assert.List(t, between("ab", "b", 0), []string{"ab", "abc", "abd"})
+	assert.List(t, between("abb", "", 2), []string{"abc", "abd"})
+	assert.List(t, between("ab\x00", "ba", 0), []string{"abc", "abd", "b"})
+	assert.List(t, between("bb", "", 0), []string{"c"})
+	assert.List(t, between("d", "", 0), []string{})
+	assert.List(t, between("", "a", 0), []string{})
+}
+
+func keyIndexKeys(index *keyIndex[int], prefix string) []string {
+	keys := make([]string, 0)
+	for _, item := range index.prefixed(prefix) {
+		keys = append(keys, item.key)
+	}
+	return keys
+}
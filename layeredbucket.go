@@ -1,10 +1,16 @@
 package ccache
 
 import (
+	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 )
 
+// Whether the item, of the given group, was invalidated (see
+// LayeredCache.isStale)
+type staleFunc[T any] func(bucket *bucket[T], item *Item[T]) bool
+
 type layeredBucket[T any] struct {
 	sync.RWMutex
 	buckets map[string]*bucket[T]
@@ -20,14 +26,6 @@ func (b *layeredBucket[T]) itemCount() int {
 	return count
 }
 
-func (b *layeredBucket[T]) get(primary, secondary string) *Item[T] {
-	bucket := b.getSecondaryBucket(primary)
-	if bucket == nil {
-		return nil
-	}
-	return bucket.get(secondary)
-}
-
 func (b *layeredBucket[T]) getSecondaryBucket(primary string) *bucket[T] {
 	b.RLock()
 	bucket, exists := b.buckets[primary]
@@ -38,77 +36,215 @@ func (b *layeredBucket[T]) getSecondaryBucket(primary string) *bucket[T] {
 	return bucket
 }
 
-func (b *layeredBucket[T]) set(primary, secondary string, value T, duration time.Duration, track bool) (*Item[T], *Item[T]) {
+// We hold the write lock for the entire set so that the secondary bucket
+// can't be reclaimed between the time we get it and the time we set the
+// value into it
+func (b *layeredBucket[T]) set(primary, secondary string, value T, duration time.Duration, track bool, cacheGeneration uint64) (*Item[T], *Item[T]) {
+	expires := time.Now().Add(duration).UnixNano()
+	item := newItem(secondary, value, expires, track)
+	item.group = primary
+	if cacheGeneration != 0 {
+		item.extend().cacheGeneration = cacheGeneration
+	}
+
 	b.Lock()
+	defer b.Unlock()
 	bkt, exists := b.buckets[primary]
 	if !exists {
 		bkt = &bucket[T]{lookup: make(map[string]*Item[T])}
 		b.buckets[primary] = bkt
 	}
-	b.Unlock()
-	item, existing := bkt.set(secondary, value, duration, track)
-	item.group = primary
-	return item, existing
+	return item, bkt.setItem(item)
 }
 
-func (b *layeredBucket[T]) remove(primary, secondary string) *Item[T] {
+// Returns the removed item, if any, and whether it was visible (rather than
+// stale)
+func (b *layeredBucket[T]) remove(primary, secondary string, stale staleFunc[T]) (*Item[T], bool) {
 	b.RLock()
 	bucket, exists := b.buckets[primary]
 	b.RUnlock()
 	if !exists {
-		return nil
+		return nil, false
 	}
-	return bucket.remove(secondary)
+	item := bucket.remove(secondary)
+	b.reclaimIfEmpty(primary, bucket)
+	return item, item != nil && !stale(bucket, item)
 }
 
-func (b *layeredBucket[T]) delete(primary, secondary string) {
+// Removes the item from its group, unless it was replaced since
+func (b *layeredBucket[T]) removeItem(item *Item[T]) {
 	b.RLock()
-	bucket, exists := b.buckets[primary]
+	bucket, exists := b.buckets[item.group]
 	b.RUnlock()
 	if !exists {
 		return
 	}
-	bucket.delete(secondary)
+	if bucket.removeItem(item) {
+		b.reclaimIfEmpty(item.group, bucket)
+	}
+}
+
+func (b *layeredBucket[T]) deletePrefix(primary, prefix string, deletables chan *Item[T], stale staleFunc[T]) int {
+	return b.deleteFunc(primary, func(key string, item *Item[T]) bool {
+		return strings.HasPrefix(key, prefix)
+	}, deletables, stale)
 }
 
-func (b *layeredBucket[T]) deletePrefix(primary, prefix string, deletables chan *Item[T]) int {
+// Stale items are left for the worker to reclaim: matches isn't called with
+// them and they aren't counted.
+func (b *layeredBucket[T]) deleteFunc(primary string, matches func(key string, item *Item[T]) bool, deletables chan *Item[T], stale staleFunc[T]) int {
 	b.RLock()
 	bucket, exists := b.buckets[primary]
 	b.RUnlock()
 	if !exists {
 		return 0
 	}
-	return bucket.deletePrefix(prefix, deletables)
+	count := bucket.deleteFunc(func(key string, item *Item[T]) bool {
+		return !stale(bucket, item) && matches(key, item)
+	}, deletables)
+	b.reclaimIfEmpty(primary, bucket)
+	return count
 }
 
-func (b *layeredBucket[T]) deleteFunc(primary string, matches func(key string, item *Item[T]) bool, deletables chan *Item[T]) int {
+// Invalidates every item of the group, leaving it to the worker to reclaim them.
+// Returns false if the group had no visible item.
+func (b *layeredBucket[T]) invalidate(primary string, stale staleFunc[T]) bool {
 	b.RLock()
 	bucket, exists := b.buckets[primary]
 	b.RUnlock()
-	if !exists {
-		return 0
+	if !exists || !hasVisible(bucket, stale) {
+		return false
 	}
-	return bucket.deleteFunc(matches, deletables)
+	bucket.invalidate()
+	return true
 }
 
-func (b *layeredBucket[T]) deleteAll(primary string, deletables chan *Item[T]) bool {
+func (b *layeredBucket[T]) deleteAll(primary string, deletables chan *Item[T], stale staleFunc[T]) bool {
 	b.RLock()
 	bucket, exists := b.buckets[primary]
 	b.RUnlock()
 	if !exists {
 		return false
 	}
+	return b.deleteGroup(primary, bucket, deletables, stale) > 0
+}
 
-	bucket.Lock()
-	defer bucket.Unlock()
+// Deletes the secondary key from every group. Stale items are removed too,
+// but not counted.
+func (b *layeredBucket[T]) deleteSecondary(secondary string, deletables chan *Item[T], stale staleFunc[T]) int {
+	count := 0
+	b.forEachGroup(nil, func(primary string, bucket *bucket[T]) bool {
+		if item := bucket.remove(secondary); item != nil {
+			deletables <- item
+			if !stale(bucket, item) {
+				count += 1
+			}
+			b.reclaimIfEmpty(primary, bucket)
+		}
+		return true
+	})
+	return count
+}
 
-	if l := len(bucket.lookup); l == 0 {
-		return false
-	}
+// Deletes every group for which matches returns true. Groups with only stale
+// items are skipped.
+func (b *layeredBucket[T]) deleteGroupsFunc(matches func(primary string) bool, deletables chan *Item[T], stale staleFunc[T]) int {
+	count := 0
+	b.forEachGroup(stale, func(primary string, bucket *bucket[T]) bool {
+		if matches(primary) {
+			count += b.deleteGroup(primary, bucket, deletables, stale)
+		}
+		return true
+	})
+	return count
+}
+
+// Removes every item of the group, stale or not. Returns the number of
+// visible ones.
+func (b *layeredBucket[T]) deleteGroup(primary string, bucket *bucket[T], deletables chan *Item[T], stale staleFunc[T]) int {
+	count := 0
+	bucket.Lock()
+	items := make([]*Item[T], 0, len(bucket.lookup))
 	for key, item := range bucket.lookup {
 		delete(bucket.lookup, key)
+		if !stale(bucket, item) {
+			count += 1
+		}
+		items = append(items, item)
+	}
+	bucket.Unlock()
+
+	// not under the lock: the worker might be waiting for it (to evict one of
+	// the group's items) rather than reading from deletables
+	for _, item := range items {
 		deletables <- item
 	}
+	b.reclaimIfEmpty(primary, bucket)
+	return count
+}
+
+// Whether the group has at least one item which isn't stale. With a nil stale,
+// whether it has any item at all.
+func hasVisible[T any](bucket *bucket[T], stale staleFunc[T]) bool {
+	bucket.RLock()
+	defer bucket.RUnlock()
+	for _, item := range bucket.lookup {
+		if stale == nil || !stale(bucket, item) {
+			return true
+		}
+	}
+	return false
+}
+
+// Removes the secondary bucket from our map if it's (still) empty, so that
+// primary keys don't leak. SecondaryCaches might still reference the bucket,
+// so it's flagged as reclaimed and they'll go through us to get the current
+// bucket (or create a new one).
+func (b *layeredBucket[T]) reclaimIfEmpty(primary string, bkt *bucket[T]) {
+	if bkt.itemCount() != 0 {
+		return
+	}
+
+	b.Lock()
+	defer b.Unlock()
+	if b.buckets[primary] != bkt {
+		// already reclaimed
+		return
+	}
+
+	// Sets are done under our write lock, so nothing can be added to the bucket
+	// while we hold it. But something could have been added between our first
+	// check and acquiring the lock.
+	bkt.RLock()
+	defer bkt.RUnlock()
+	if len(bkt.lookup) != 0 {
+		return
+	}
+	delete(b.buckets, primary)
+	atomic.StoreInt32(&bkt.reclaimed, 1)
+}
+
+// The callback is called without holding our lock (we iterate over a snapshot
+// of our secondary buckets), so it's free to use the cache. Groups without a
+// visible item (see hasVisible) are skipped.
+func (b *layeredBucket[T]) forEachGroup(stale staleFunc[T], matches func(primary string, bucket *bucket[T]) bool) bool {
+	b.RLock()
+	primaries := make([]string, 0, len(b.buckets))
+	buckets := make([]*bucket[T], 0, len(b.buckets))
+	for primary, bucket := range b.buckets {
+		primaries = append(primaries, primary)
+		buckets = append(buckets, bucket)
+	}
+	b.RUnlock()
+
+	for i, bucket := range buckets {
+		if !hasVisible(bucket, stale) {
+			continue
+		}
+		if !matches(primaries[i], bucket) {
+			return false
+		}
+	}
 	return true
 }
 
@@ -125,6 +261,7 @@ func (b *layeredBucket[T]) forEachFunc(primary string, matches func(key string,
 func (b *layeredBucket[T]) clear() {
 	for _, bucket := range b.buckets {
 		bucket.clear()
+		atomic.StoreInt32(&bucket.reclaimed, 1)
 	}
 	b.buckets = make(map[string]*bucket[T])
 }
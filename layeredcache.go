@@ -3,6 +3,8 @@ package ccache
 
 import (
 	"hash/fnv"
+	"iter"
+	"strings"
 	"sync/atomic"
 	"time"
 )
@@ -10,13 +12,12 @@ import (
 type LayeredCache[T any] struct {
 	*Configuration[T]
 	control
-	list            *List[T]
-	buckets         []*layeredBucket[T]
-	bucketMask      uint32
-	size            int64
-	pruneTargetSize int64
-	deletables      chan *Item[T]
-	promotables     chan *Item[T]
+	cacheWorker[T]
+	buckets    []*layeredBucket[T]
+	bucketMask uint32
+	quotas     map[string]*groupQuota[T]
+	generation uint64
+	hotKeys    *hotKeys
 }
 
 // Create a new layered cache with the specified configuration.
@@ -34,21 +35,24 @@ type LayeredCache[T any] struct {
 // See ccache.Configure() for creating a configuration
 func Layered[T any](config *Configuration[T]) *LayeredCache[T] {
 	c := &LayeredCache[T]{
-		list:            NewList[T](),
-		Configuration:   config,
-		control:         newControl(),
-		bucketMask:      uint32(config.buckets) - 1,
-		buckets:         make([]*layeredBucket[T], config.buckets),
-		deletables:      make(chan *Item[T], config.deleteBuffer),
-		promotables:     make(chan *Item[T], config.promoteBuffer),
-		pruneTargetSize: config.maxSize - config.maxSize*int64(config.percentToPrune)/100,
+		Configuration: config,
+		control:       newControl(),
+		bucketMask:    uint32(config.buckets) - 1,
+		buckets:       make([]*layeredBucket[T], config.buckets),
+	}
+	c.cacheWorker = newCacheWorker[T](c, config, c.control, config.layeredPolicy)
+	if config.maxGroupSize > 0 || config.maxGroupItems > 0 {
+		c.quotas = make(map[string]*groupQuota[T])
+	}
+	if config.hotKeys > 0 {
+		c.hotKeys = newHotKeys(config.hotKeys, config.hotKeysWindow)
 	}
 	for i := 0; i < config.buckets; i++ {
 		c.buckets[i] = &layeredBucket[T]{
 			buckets: make(map[string]*bucket[T]),
 		}
 	}
-	go c.worker()
+	c.start()
 	return c
 }
 
@@ -65,7 +69,7 @@ func (c *LayeredCache[T]) ItemCount() int {
 // is expired and item.TTL() to see how long until the item expires (which
 // will be negative for an already expired item).
 func (c *LayeredCache[T]) Get(primary, secondary string) *Item[T] {
-	item := c.bucket(primary).get(primary, secondary)
+	item := c.get(primary, secondary)
 	if item == nil {
 		return nil
 	}
@@ -82,29 +86,170 @@ func (c *LayeredCache[T]) Get(primary, secondary string) *Item[T] {
 // "least recently used" aspect of this cache. To some degree, it's akin to a
 // "peak"
 func (c *LayeredCache[T]) GetWithoutPromote(primary, secondary string) *Item[T] {
-	return c.bucket(primary).get(primary, secondary)
+	return c.get(primary, secondary)
 }
 
 func (c *LayeredCache[T]) ForEachFunc(primary string, matches func(key string, item *Item[T]) bool) {
-	c.bucket(primary).forEachFunc(primary, matches)
+	if !c.generational {
+		c.bucket(primary).forEachFunc(primary, matches)
+		return
+	}
+	bucket := c.bucket(primary).getSecondaryBucket(primary)
+	if bucket == nil {
+		return
+	}
+	bucket.forEachFunc(func(key string, item *Item[T]) bool {
+		return c.isStale(bucket, item) || matches(key, item)
+	})
+}
+
+// Returns the primary keys which currently have at least one item. The order
+// is random.
+func (c *LayeredCache[T]) Primaries() []string {
+	primaries := make([]string, 0)
+	c.ForEachGroup(func(primary string, sc *SecondaryCache[T]) bool {
+		primaries = append(primaries, primary)
+		return true
+	})
+	return primaries
+}
+
+// Returns the number of items that share the primary key
+func (c *LayeredCache[T]) GroupCount(primary string) int {
+	bucket := c.bucket(primary).getSecondaryBucket(primary)
+	if bucket == nil {
+		return 0
+	}
+	return bucket.itemCount()
+}
+
+// Iterates through every primary key which has at least one item, passing it
+// and its SecondaryCache to the provided function. Iteration stops if the
+// function returns false. Iteration order is random. Groups which are added
+// while iterating may or may not be seen.
+func (c *LayeredCache[T]) ForEachGroup(matches func(primary string, sc *SecondaryCache[T]) bool) {
+	for _, b := range c.buckets {
+		keepGoing := b.forEachGroup(c.isStale, func(primary string, bucket *bucket[T]) bool {
+			return matches(primary, &SecondaryCache[T]{
+				primary: primary,
+				bucket:  bucket,
+				pCache:  c,
+			})
+		})
+		if !keepGoing {
+			return
+		}
+	}
+}
+
+// Iterates through every item in the cache, across all primary keys.
+// Iteration stops if the function returns false. Iteration order is random.
+func (c *LayeredCache[T]) ForEachAll(matches func(primary string, secondary string, item *Item[T]) bool) {
+	for _, b := range c.buckets {
+		keepGoing := b.forEachGroup(c.isStale, func(primary string, bucket *bucket[T]) bool {
+			return bucket.forEachFunc(func(secondary string, item *Item[T]) bool {
+				return c.isStale(bucket, item) || matches(primary, secondary, item)
+			})
+		})
+		if !keepGoing {
+			return
+		}
+	}
+}
+
+// Iterates over every item in the cache, across all primary keys, in random
+// order. The yielded key is the item's secondary key, its primary key is
+// available via item.Group(). Groups are visited one at a time: each is copied
+// while holding its read lock, which is released before any of its items are
+// yielded, so the loop's body is free to use the cache. Items set or deleted
+// during the iteration may or may not be seen.
+func (c *LayeredCache[T]) All() iter.Seq2[string, *Item[T]] {
+	return func(yield func(string, *Item[T]) bool) {
+		for _, b := range c.buckets {
+			keepGoing := b.forEachGroup(c.isStale, func(primary string, bucket *bucket[T]) bool {
+				for _, item := range bucket.items() {
+					if c.isStale(bucket, item) {
+						continue
+					}
+					if !yield(item.key, item) {
+						return false
+					}
+				}
+				return true
+			})
+			if !keepGoing {
+				return
+			}
+		}
+	}
+}
+
+// The secondary keys of every item in the cache. Same semantics as All.
+func (c *LayeredCache[T]) Keys() iter.Seq[string] {
+	return func(yield func(string) bool) {
+		for key := range c.All() {
+			if !yield(key) {
+				return
+			}
+		}
+	}
+}
+
+// The values of every item in the cache. Same semantics as All.
+func (c *LayeredCache[T]) Values() iter.Seq[T] {
+	return func(yield func(T) bool) {
+		for _, item := range c.All() {
+			if !yield(item.value) {
+				return
+			}
+		}
+	}
+}
+
+// Iterates over every item, from the most to the least recently used, across
+// all primary keys. The yielded key is the item's secondary key. Same semantics
+// as Cache.ByRecency.
+func (c *LayeredCache[T]) ByRecency() iter.Seq2[string, *Item[T]] {
+	return func(yield func(string, *Item[T]) bool) {
+		for _, item := range c.recencySnapshot() {
+			if c.get(item.group, item.key) != item {
+				continue
+			}
+			if !yield(item.key, item) {
+				return
+			}
+		}
+	}
+}
+
+func (c *LayeredCache[T]) recencySnapshot() []*Item[T] {
+	res := make(chan []*Item[T], 1)
+	c.control <- controlRecency{res: res}
+	return <-res
 }
 
 // Get the secondary cache for a given primary key. This operation will
-// never return nil. In the case where the primary key does not exist, a
-// new, underlying, empty bucket will be created and returned.
+// never return nil. In the case where the primary key does not exist, the
+// returned cache is empty. Nothing is allocated for the primary key until an
+// item is set through it.
 func (c *LayeredCache[T]) GetOrCreateSecondaryCache(primary string) *SecondaryCache[T] {
-	primaryBkt := c.bucket(primary)
-	bkt := primaryBkt.getSecondaryBucket(primary)
-	primaryBkt.Lock()
-	if bkt == nil {
-		bkt = &bucket[T]{lookup: make(map[string]*Item[T])}
-		primaryBkt.buckets[primary] = bkt
-	}
-	primaryBkt.Unlock()
 	return &SecondaryCache[T]{
-		bucket: bkt,
-		pCache: c,
+		primary: primary,
+		bucket:  c.bucket(primary).getSecondaryBucket(primary),
+		pCache:  c,
+	}
+}
+
+// The (up to) n most accessed keys, most accessed first. Returns nil unless
+// the cache was configured with TrackHotKeys.
+// This is a control command.
+func (c *LayeredCache[T]) TopKeys(n int) []HotKey {
+	if c.hotKeys == nil {
+		return nil
 	}
+	res := make(chan []HotKey)
+	c.control <- controlTopKeys{n: n, res: res}
+	return <-res
 }
 
 // Used when the cache was created with the Track() configuration option.
@@ -132,7 +277,7 @@ func (c *LayeredCache[T]) Set(primary, secondary string, value T, duration time.
 // Returns true if the item existed an was replaced, false otherwise.
 // Replace does not reset item's TTL nor does it alter its position in the LRU
 func (c *LayeredCache[T]) Replace(primary, secondary string, value T) bool {
-	item := c.bucket(primary).get(primary, secondary)
+	item := c.get(primary, secondary)
 	if item == nil {
 		return false
 	}
@@ -160,31 +305,82 @@ func (c *LayeredCache[T]) Fetch(primary, secondary string, duration time.Duratio
 
 // Remove the item from the cache, return true if the item was present, false otherwise.
 func (c *LayeredCache[T]) Delete(primary, secondary string) bool {
-	item := c.bucket(primary).remove(primary, secondary)
+	item, visible := c.bucket(primary).remove(primary, secondary, c.isStale)
 	if item != nil {
 		c.deletables <- item
-		return true
 	}
-	return false
+	return visible
 }
 
-// Deletes all items that share the same primary key
+// Deletes all items that share the same primary key. In generational mode
+// (see Configuration.Generational), this is O(1): the items immediately become
+// invisible and are reclaimed by the worker at a later time.
 func (c *LayeredCache[T]) DeleteAll(primary string) bool {
-	return c.bucket(primary).deleteAll(primary, c.deletables)
+	if !c.generational {
+		return c.bucket(primary).deleteAll(primary, c.deletables, c.isStale)
+	}
+	if !c.bucket(primary).invalidate(primary, c.isStale) {
+		return false
+	}
+	c.reclaim(controlReclaim{primary: primary})
+	return true
+}
+
+// In generational mode (see Configuration.Generational), makes every item in
+// the cache invisible in O(1). Like DeleteAll, the items are reclaimed by the
+// worker at a later time. Unlike Clear, this doesn't block any operation.
+// Items set concurrently with the call to Invalidate may or may not be
+// invalidated.
+// Without generational mode, this is the same as calling Clear.
+func (c *LayeredCache[T]) Invalidate() {
+	if !c.generational {
+		c.Clear()
+		return
+	}
+	atomic.AddUint64(&c.generation, 1)
+	c.reclaim(controlReclaim{all: true})
 }
 
 // Deletes all items that share the same primary key and prefix.
 func (c *LayeredCache[T]) DeletePrefix(primary, prefix string) int {
-	return c.bucket(primary).deletePrefix(primary, prefix, c.deletables)
+	return c.bucket(primary).deletePrefix(primary, prefix, c.deletables, c.isStale)
 }
 
 // Deletes all items that share the same primary key and where the matches func evaluates to true.
 func (c *LayeredCache[T]) DeleteFunc(primary string, matches func(key string, item *Item[T]) bool) int {
-	return c.bucket(primary).deleteFunc(primary, matches, c.deletables)
+	return c.bucket(primary).deleteFunc(primary, matches, c.deletables, c.isStale)
+}
+
+// Deletes the secondary key from every primary key. Returns the number of
+// items deleted. This has to visit every group in the cache.
+func (c *LayeredCache[T]) DeleteSecondary(secondary string) int {
+	count := 0
+	for _, b := range c.buckets {
+		count += b.deleteSecondary(secondary, c.deletables, c.isStale)
+	}
+	return count
+}
+
+// Deletes all items of every primary key which starts with prefix. Returns the
+// number of items deleted.
+func (c *LayeredCache[T]) DeletePrimaryPrefix(prefix string) int {
+	return c.DeleteGroupsFunc(func(primary string) bool {
+		return strings.HasPrefix(primary, prefix)
+	})
+}
+
+// Deletes all items of every primary key for which matches returns true.
+// Returns the number of items deleted.
+func (c *LayeredCache[T]) DeleteGroupsFunc(matches func(primary string) bool) int {
+	count := 0
+	for _, b := range c.buckets {
+		count += b.deleteGroupsFunc(matches, c.deletables, c.isStale)
+	}
+	return count
 }
 
 func (c *LayeredCache[T]) set(primary, secondary string, value T, duration time.Duration, track bool) *Item[T] {
-	item, existing := c.bucket(primary).set(primary, secondary, value, duration, track)
+	item, existing := c.bucket(primary).set(primary, secondary, value, duration, track, atomic.LoadUint64(&c.generation))
 	if existing != nil {
 		c.deletables <- existing
 	}
@@ -192,6 +388,41 @@ func (c *LayeredCache[T]) set(primary, secondary string, value T, duration time.
 	return item
 }
 
+// Gets the item, treating invalidated items (in generational mode) as missing
+func (c *LayeredCache[T]) get(primary, secondary string) *Item[T] {
+	bucket := c.bucket(primary).getSecondaryBucket(primary)
+	if bucket == nil {
+		return nil
+	}
+	return c.visible(bucket, bucket.get(secondary))
+}
+
+func (c *LayeredCache[T]) visible(bucket *bucket[T], item *Item[T]) *Item[T] {
+	if item == nil || c.isStale(bucket, item) {
+		return nil
+	}
+	return item
+}
+
+// Whether the item was invalidated by DeleteAll or Invalidate. Always false
+// outside of generational mode.
+func (c *LayeredCache[T]) isStale(bucket *bucket[T], item *Item[T]) bool {
+	if !c.generational {
+		return false
+	}
+	return bucket.isStale(item) || item.cacheGeneration() != atomic.LoadUint64(&c.generation)
+}
+
+// Asks the worker to reclaim invalidated items. If the worker is busy (the
+// control buffer is full), the items will eventually be reclaimed by a later
+// request, by gc, or when they're replaced.
+func (c *LayeredCache[T]) reclaim(msg controlReclaim) {
+	select {
+	case c.control <- msg:
+	default:
+	}
+}
+
 func (c *LayeredCache[T]) bucket(key string) *layeredBucket[T] {
 	h := fnv.New32a()
 	h.Write([]byte(key))
@@ -220,137 +451,145 @@ func (c *LayeredCache[T]) promote(item *Item[T]) {
 	c.promotables <- item
 }
 
-func (c *LayeredCache[T]) worker() {
-	dropped := 0
-	cc := c.control
-
-	promoteItem := func(item *Item[T]) {
-		if c.doPromote(item) && c.size > c.maxSize {
-			dropped += c.gc()
+// Handles the control messages which are specific to the LayeredCache. Only
+// the worker should call this
+func (c *LayeredCache[T]) handle(msg interface{}) {
+	switch msg := msg.(type) {
+	case controlClear:
+		promotables := c.promotables
+		for len(promotables) > 0 {
+			<-promotables
+		}
+		deletables := c.deletables
+		for len(deletables) > 0 {
+			<-deletables
 		}
-	}
-
-	for {
-		select {
-		case item := <-c.promotables:
-			promoteItem(item)
-		case item := <-c.deletables:
-			c.doDelete(item)
-		case control := <-cc:
-			switch msg := control.(type) {
-			case controlStop:
-				goto drain
-			case controlGetDropped:
-				msg.res <- dropped
-				dropped = 0
-			case controlSetMaxSize:
-				newMaxSize := msg.size
-				c.maxSize = newMaxSize
-				c.pruneTargetSize = newMaxSize - newMaxSize*int64(c.percentToPrune)/100
-				if c.size > c.maxSize {
-					dropped += c.gc()
-				}
-				msg.done <- struct{}{}
-			case controlClear:
-				promotables := c.promotables
-				for len(promotables) > 0 {
-					<-promotables
-				}
-				deletables := c.deletables
-				for len(deletables) > 0 {
-					<-deletables
-				}
 
-				c.halted(func() {
-					for _, bucket := range c.buckets {
-						bucket.clear()
-					}
-					c.size = 0
-					c.list = NewList[T]()
+		c.halted(func() {
+			for _, bucket := range c.buckets {
+				bucket.clear()
+			}
+			c.reset()
+			if c.quotas != nil {
+				c.quotas = make(map[string]*groupQuota[T])
+			}
+		})
+		msg.done <- struct{}{}
+	case controlTopKeys:
+		msg.res <- c.hotKeys.top(msg.n)
+	case controlReclaim:
+		if msg.all {
+			for _, lb := range c.buckets {
+				lb.forEachGroup(nil, func(primary string, b *bucket[T]) bool {
+					c.reclaimGroup(lb, primary, b)
+					return true
 				})
-				msg.done <- struct{}{}
-			case controlGetSize:
-				msg.res <- c.size
-			case controlGC:
-				dropped += c.gc()
-				msg.done <- struct{}{}
-			case controlSyncUpdates:
-				doAllPendingPromotesAndDeletes(c.promotables, promoteItem, c.deletables, c.doDelete)
-				msg.done <- struct{}{}
+			}
+		} else {
+			lb := c.bucket(msg.primary)
+			if b := lb.getSecondaryBucket(msg.primary); b != nil {
+				c.reclaimGroup(lb, msg.primary, b)
 			}
 		}
 	}
+}
 
-drain:
-	for {
-		select {
-		case item := <-c.deletables:
-			c.doDelete(item)
-		default:
-			return
-		}
-	}
+// Only the Cache has work to do after each message
+func (c *LayeredCache[T]) processed() {
 }
 
 func (c *LayeredCache[T]) doDelete(item *Item[T]) {
 	if !item.inList {
 		item.promotions = -2
 	} else {
-		c.size -= item.size
+		c.untrack(item)
 		if c.onDelete != nil {
 			c.onDelete(item)
 		}
-		c.list.Remove(item)
+		c.removeFromGroup(item)
 		item.promotions = -2
 	}
 }
 
 func (c *LayeredCache[T]) doPromote(item *Item[T]) bool {
-	// deleted before it ever got promoted
-	if item.promotions == -2 {
-		return false
+	if c.hotKeys != nil {
+		c.hotKeys.record(item.group, item.key)
 	}
-
-	if item.inList {
-		if item.shouldPromote(c.getsPerPromote) {
-			c.list.MoveToFront(item)
-			item.promotions = 0
+	added, promoted := c.track(item)
+	if c.quotas == nil {
+		return added
+	}
+	if promoted {
+		c.quotas[item.group].moveToFront(item)
+	} else if added {
+		g := c.quotas[item.group]
+		if g == nil {
+			g = &groupQuota[T]{}
+			c.quotas[item.group] = g
 		}
-		return false
+		g.insert(item)
+		c.dropped += c.gcGroup(item.group)
 	}
-
-	c.size += item.size
-	c.list.Insert(item)
-	return true
+	return added
 }
 
-func (c *LayeredCache[T]) gc() int {
+// Evicts the group's least recently used items until the group is within its
+// quota
+func (c *LayeredCache[T]) gcGroup(group string) int {
+	g := c.quotas[group]
+	if g == nil {
+		return 0
+	}
 	dropped := 0
-	item := c.list.Tail
-
-	prunedSize := int64(0)
-	sizeToPrune := c.size - c.pruneTargetSize
-
-	for prunedSize < sizeToPrune {
-		if item == nil {
-			return dropped
-		}
-		prev := item.prev
-		if !c.tracking || atomic.LoadInt32(&item.refCount) == 0 {
-
-			c.bucket(item.group).delete(item.group, item.key)
-			itemSize := item.size
-			c.size -= itemSize
-			prunedSize += itemSize
-
-			c.list.Remove(item)
-			if c.onDelete != nil {
-				c.onDelete(item)
-			}
+	item := g.tail
+	for item != nil && g.over(c.maxGroupSize, c.maxGroupItems) {
+		prev := item.workerState().groupPrev
+		if c.evictable(item) {
+			c.evict(item)
 			dropped += 1
-			item.promotions = -2
 		}
 		item = prev
 	}
 	return dropped
 }
+
+func (c *LayeredCache[T]) removeFromGroup(item *Item[T]) {
+	if c.quotas == nil {
+		return
+	}
+	g := c.quotas[item.group]
+	if g == nil {
+		return
+	}
+	g.remove(item)
+	if g.count == 0 {
+		delete(c.quotas, item.group)
+	}
+}
+
+// Removes the group's invalidated items
+func (c *LayeredCache[T]) reclaimGroup(lb *layeredBucket[T], primary string, bucket *bucket[T]) {
+	stale := bucket.removeFunc(func(item *Item[T]) bool {
+		return c.isStale(bucket, item)
+	})
+	for _, item := range stale {
+		c.doDelete(item)
+	}
+	lb.reclaimIfEmpty(primary, bucket)
+}
+
+// tracked items that haven't been released can't be evicted
+func (c *LayeredCache[T]) evictable(item *Item[T]) bool {
+	return !c.tracking || atomic.LoadInt32(&item.refCount) == 0
+}
+
+// removes the item from the lookup and the policy. Only the worker should call this
+func (c *LayeredCache[T]) evict(item *Item[T]) {
+	c.bucket(item.group).removeItem(item)
+	c.untrack(item)
+	c.removeFromGroup(item)
+	if c.onDelete != nil {
+		c.onDelete(item)
+	}
+	item.promotions = -2
+}
@@ -481,6 +481,620 @@ func Test_LayeredCachePrune(t *testing.T) {
 	}
 }
 
+func Test_LayeredCache_EvictOldest(t *testing.T) {
+	deleted := int32(0)
+	cache := Layered(Configure[int]().OnDelete(func(item *Item[int]) {
+		atomic.AddInt32(&deleted, 1)
+	}))
+	defer cache.Stop()
+
+	for i := 0; i < 10; i++ {
+		cache.Set(strconv.Itoa(i), "a", i, time.Minute)
+	}
+	cache.SyncUpdates()
+	assert.Equal(t, cache.EvictOldest(3), 3)
+	assert.Equal(t, cache.Get("2", "a"), nil)
+	assert.Equal(t, cache.Get("3", "a").Value(), 3)
+	assert.Equal(t, cache.GetSize(), 7)
+	assert.Equal(t, atomic.LoadInt32(&deleted), 3)
+}
+
+func Test_LayeredCache_ShrinkTo(t *testing.T) {
+	cache := Layered(Configure[*SizedItem]())
+	defer cache.Stop()
+
+	for i := 0; i < 10; i++ {
+		cache.Set("p", strconv.Itoa(i), &SizedItem{i, 2}, time.Minute)
+	}
+	cache.SyncUpdates()
+	assert.Equal(t, cache.ShrinkTo(15), 3)
+	assert.Equal(t, cache.GetSize(), 14)
+	assert.Equal(t, cache.Get("p", "2"), nil)
+	assert.Equal(t, cache.Get("p", "3").Value().id, 3)
+}
+
+func Test_LayeredCache_PurgeExpired(t *testing.T) {
+	cache := Layered(Configure[int]())
+	defer cache.Stop()
+
+	cache.Set("p", "a", 1, time.Minute)
+	cache.Set("p", "b", 2, -time.Minute)
+	cache.Set("q", "a", 3, -time.Minute)
+	cache.SyncUpdates()
+
+	assert.Equal(t, cache.PurgeExpired(), 2)
+	assert.Equal(t, cache.Get("p", "b"), nil)
+	assert.Equal(t, cache.Get("q", "a"), nil)
+	assert.Equal(t, cache.Get("p", "a").Value(), 1)
+	assert.Equal(t, cache.GetSize(), 1)
+}
+
+func Test_LayeredCache_PrunesExpiredItemsFirst(t *testing.T) {
+	cache := Layered(Configure[int]().MaxSize(10).PercentToPrune(20).PruneExpiredFirst())
+	defer cache.Stop()
+
+	for i := 0; i < 10; i++ {
+		ttl := time.Minute
+		if i == 5 || i == 7 {
+			ttl = -time.Minute
+		}
+		cache.Set(strconv.Itoa(i), "a", i, ttl)
+	}
+	cache.SyncUpdates()
+	cache.Set("10", "a", 10, time.Minute)
+	cache.SyncUpdates()
+
+	assert.Equal(t, cache.GetDropped(), 3)
+	assert.Equal(t, cache.Get("5", "a"), nil)
+	assert.Equal(t, cache.Get("7", "a"), nil)
+	assert.Equal(t, cache.Get("0", "a"), nil)
+	assert.Equal(t, cache.Get("1", "a").Value(), 1)
+	assert.Equal(t, cache.GetSize(), 8)
+}
+
+func Test_LayeredCache_MaxGroupItems(t *testing.T) {
+	cache := Layered(Configure[int]().MaxGroupItems(3).GetsPerPromote(1))
+	defer cache.Stop()
+
+	for i := 0; i < 3; i++ {
+		cache.Set("tenant-a", strconv.Itoa(i), i, time.Minute)
+		cache.Set("tenant-b", strconv.Itoa(i), i, time.Minute)
+	}
+	cache.SyncUpdates()
+	cache.Get("tenant-a", "0")
+	cache.SyncUpdates()
+
+	cache.Set("tenant-a", "3", 3, time.Minute)
+	cache.SyncUpdates()
+	assert.Equal(t, cache.Get("tenant-a", "0").Value(), 0)
+	assert.Equal(t, cache.Get("tenant-a", "1"), nil)
+	assert.Equal(t, cache.Get("tenant-a", "2").Value(), 2)
+	assert.Equal(t, cache.Get("tenant-a", "3").Value(), 3)
+	assert.Equal(t, cache.GetDropped(), 1)
+
+	// other groups are untouched
+	assert.Equal(t, cache.Get("tenant-b", "0").Value(), 0)
+	assert.Equal(t, cache.ItemCount(), 6)
+}
+
+func Test_LayeredCache_MaxGroupItemsKeepsReplacements(t *testing.T) {
+	cache := Layered(Configure[int]().MaxGroupItems(1))
+	defer cache.Stop()
+
+	cache.Set("tenant-a", "0", 0, time.Minute)
+	cache.SyncUpdates()
+
+	// the worker sees the replacement before the replaced item's deletion,
+	// so the group's quota evicts the replaced item
+	item, existing := cache.bucket("tenant-a").set("tenant-a", "0", 1, time.Minute, false, 0)
+	cache.promotables <- item
+	cache.SyncUpdates()
+	assert.Equal(t, cache.Get("tenant-a", "0").Value(), 1)
+
+	cache.deletables <- existing
+	cache.SyncUpdates()
+	assert.Equal(t, cache.Get("tenant-a", "0").Value(), 1)
+	assert.Equal(t, cache.GetSize(), 1)
+}
+
+func Test_LayeredCache_MaxGroupSize(t *testing.T) {
+	cache := Layered(Configure[*SizedItem]().MaxGroupSize(10))
+	defer cache.Stop()
+
+	cache.Set("a", "0", &SizedItem{0, 4}, time.Minute)
+	cache.Set("a", "1", &SizedItem{1, 4}, time.Minute)
+	cache.Set("b", "0", &SizedItem{0, 8}, time.Minute)
+	cache.SyncUpdates()
+	assert.Equal(t, cache.GetDropped(), 0)
+
+	cache.Set("a", "2", &SizedItem{2, 3}, time.Minute)
+	cache.SyncUpdates()
+	assert.Equal(t, cache.Get("a", "0"), nil)
+	assert.Equal(t, cache.Get("a", "1").Value().id, 1)
+	assert.Equal(t, cache.Get("a", "2").Value().id, 2)
+	assert.Equal(t, cache.GetSize(), 15)
+
+	// replacing and deleting items keeps the group's size accurate
+	cache.Set("a", "1", &SizedItem{1, 1}, time.Minute)
+	cache.Delete("a", "2")
+	cache.SyncUpdates()
+	cache.Set("a", "3", &SizedItem{3, 9}, time.Minute)
+	cache.SyncUpdates()
+	assert.Equal(t, cache.Get("a", "1").Value().id, 1)
+	assert.Equal(t, cache.Get("a", "3").Value().id, 3)
+	assert.Equal(t, cache.GetDropped(), 1)
+}
+
+func Test_LayeredCache_GroupQuotaAppliesToSecondaryCaches(t *testing.T) {
+	cache := Layered(Configure[int]().MaxGroupItems(2))
+	defer cache.Stop()
+
+	sc := cache.GetOrCreateSecondaryCache("a")
+	sc.Set("0", 0, time.Minute)
+	sc.Set("1", 1, time.Minute)
+	sc.Set("2", 2, time.Minute)
+	cache.SyncUpdates()
+	assert.Equal(t, cache.Get("a", "0"), nil)
+	assert.Equal(t, sc.Get("0"), nil)
+	assert.Equal(t, cache.Get("a", "2").Value(), 2)
+	assert.Equal(t, cache.ItemCount(), 2)
+}
+
+func Test_LayeredCache_ReclaimsEmptyPrimaryBuckets(t *testing.T) {
+	cache := Layered(Configure[int]().MaxSize(3).PercentToPrune(1))
+	defer cache.Stop()
+
+	cache.Set("a", "1", 1, time.Minute)
+	cache.Set("a", "2", 2, time.Minute)
+	cache.Set("b", "1", 1, time.Minute)
+	cache.Set("c", "1", 1, time.Minute)
+	cache.Set("d", "1", 1, time.Minute)
+	cache.SyncUpdates()
+	// both of "a"'s items were evicted by gc
+	assert.Equal(t, primaryCount(cache), 3)
+	assert.Equal(t, cache.GetDropped(), 2)
+
+	cache.Delete("b", "1")
+	assert.Equal(t, primaryCount(cache), 2)
+
+	cache.DeleteAll("c")
+	assert.Equal(t, primaryCount(cache), 1)
+
+	cache.Set("e", "1", 1, time.Minute)
+	cache.Set("e", "2", 2, time.Minute)
+	cache.SyncUpdates()
+	assert.Equal(t, primaryCount(cache), 2)
+
+	cache.DeletePrefix("e", "")
+	cache.DeleteFunc("d", func(key string, item *Item[int]) bool { return true })
+	assert.Equal(t, primaryCount(cache), 0)
+}
+
+func Test_LayeredCache_SecondaryCacheSurvivesReclaim(t *testing.T) {
+	cache := newLayered[string]()
+	defer cache.Stop()
+
+	sCache := cache.GetOrCreateSecondaryCache("spice")
+	sCache.Set("flow", "a", time.Minute)
+	sCache.Delete("flow")
+	assert.Equal(t, primaryCount(cache), 0)
+	assert.Equal(t, sCache.Get("flow"), nil)
+
+	// setting through the stale secondary cache creates a new bucket which is
+	// visible from both sides
+	sCache.Set("flow", "b", time.Minute)
+	assert.Equal(t, primaryCount(cache), 1)
+	assert.Equal(t, cache.Get("spice", "flow").Value(), "b")
+	assert.Equal(t, sCache.Get("flow").Value(), "b")
+
+	cache.Set("spice", "must", "c", time.Minute)
+	assert.Equal(t, sCache.Get("must").Value(), "c")
+	assert.Equal(t, sCache.Delete("must"), true)
+	assert.Equal(t, cache.Get("spice", "must"), nil)
+}
+
+func Test_LayeredCache_ConcurrentReclaimAndSet(t *testing.T) {
+	cache := Layered(Configure[int]())
+	defer cache.Stop()
+
+	sCache := cache.GetOrCreateSecondaryCache("p")
+	done := make(chan struct{})
+	go func() {
+		for i := 0; i < 10000; i++ {
+			cache.Delete("p", "a")
+		}
+		close(done)
+	}()
+	for i := 0; i < 10000; i++ {
+		sCache.Set("b", i, time.Minute)
+		cache.Set("p", "a", i, time.Minute)
+		assert.Equal(t, cache.Get("p", "b").Value(), i)
+	}
+	<-done
+	assert.Equal(t, sCache.Get("b").Value(), 9999)
+}
+
+func Test_LayeredCache_Primaries(t *testing.T) {
+	cache := newLayered[int]()
+	defer cache.Stop()
+
+	assert.List(t, cache.Primaries(), []string{})
+
+	cache.Set("a", "1", 1, time.Minute)
+	cache.Set("a", "2", 2, time.Minute)
+	cache.Set("b", "1", 3, time.Minute)
+	cache.GetOrCreateSecondaryCache("empty")
+	primaries := cache.Primaries()
+	sort.Strings(primaries)
+	assert.List(t, primaries, []string{"a", "b"})
+
+	assert.Equal(t, cache.GroupCount("a"), 2)
+	assert.Equal(t, cache.GroupCount("b"), 1)
+	assert.Equal(t, cache.GroupCount("empty"), 0)
+	assert.Equal(t, cache.GroupCount("nope"), 0)
+}
+
+func Test_LayeredCache_ForEachGroup(t *testing.T) {
+	cache := newLayered[int]()
+	defer cache.Stop()
+
+	cache.Set("a", "1", 1, time.Minute)
+	cache.Set("a", "2", 2, time.Minute)
+	cache.Set("b", "1", 3, time.Minute)
+
+	counts := make(map[string]int)
+	cache.ForEachGroup(func(primary string, sc *SecondaryCache[int]) bool {
+		counts[primary] = sc.Get("1").Value()
+		// the cache can be used from within the callback
+		sc.Set("3", 3, time.Minute)
+		return true
+	})
+	assert.Equal(t, len(counts), 2)
+	assert.Equal(t, counts["a"], 1)
+	assert.Equal(t, counts["b"], 3)
+	assert.Equal(t, cache.GroupCount("a"), 3)
+
+	seen := 0
+	cache.ForEachGroup(func(primary string, sc *SecondaryCache[int]) bool {
+		seen += 1
+		return false
+	})
+	assert.Equal(t, seen, 1)
+}
+
+func Test_LayeredCache_ForEachAll(t *testing.T) {
+	cache := newLayered[int]()
+	defer cache.Stop()
+
+	cache.Set("a", "1", 1, time.Minute)
+	cache.Set("a", "2", 2, time.Minute)
+	cache.Set("b", "1", 3, time.Minute)
+
+	keys := make([]string, 0)
+	total := 0
+	cache.ForEachAll(func(primary string, secondary string, item *Item[int]) bool {
+		keys = append(keys, primary+":"+secondary)
+		total += item.Value()
+		return true
+	})
+	sort.Strings(keys)
+	assert.List(t, keys, []string{"a:1", "a:2", "b:1"})
+	assert.Equal(t, total, 6)
+
+	seen := 0
+	cache.ForEachAll(func(primary string, secondary string, item *Item[int]) bool {
+		seen += 1
+		return false
+	})
+	assert.Equal(t, seen, 1)
+}
+
+func Test_LayeredCache_DeleteSecondary(t *testing.T) {
+	deleted := int32(0)
+	cache := Layered(Configure[string]().OnDelete(func(item *Item[string]) {
+		atomic.AddInt32(&deleted, 1)
+	}))
+	defer cache.Stop()
+
+	cache.Set("/users/1", ".json", "a", time.Minute)
+	cache.Set("/users/1", ".xml", "b", time.Minute)
+	cache.Set("/users/2", ".xml", "c", time.Minute)
+	cache.Set("/users/3", ".json", "d", time.Minute)
+	cache.SyncUpdates()
+
+	assert.Equal(t, cache.DeleteSecondary(".xml"), 2)
+	cache.SyncUpdates()
+	assert.Equal(t, cache.Get("/users/1", ".xml"), nil)
+	assert.Equal(t, cache.Get("/users/2", ".xml"), nil)
+	assert.Equal(t, cache.Get("/users/1", ".json").Value(), "a")
+	assert.Equal(t, cache.Get("/users/3", ".json").Value(), "d")
+	assert.Equal(t, cache.GroupCount("/users/2"), 0)
+	assert.Equal(t, cache.GetSize(), 2)
+	assert.Equal(t, atomic.LoadInt32(&deleted), 2)
+	assert.Equal(t, cache.DeleteSecondary(".xml"), 0)
+}
+
+func Test_LayeredCache_DeletePrimaryPrefix(t *testing.T) {
+	cache := newLayered[string]()
+	defer cache.Stop()
+
+	cache.Set("/users/1", ".json", "a", time.Minute)
+	cache.Set("/users/1", ".xml", "b", time.Minute)
+	cache.Set("/users/2", ".xml", "c", time.Minute)
+	cache.Set("/posts/1", ".json", "d", time.Minute)
+	cache.SyncUpdates()
+
+	assert.Equal(t, cache.DeletePrimaryPrefix("/nope"), 0)
+	assert.Equal(t, cache.DeletePrimaryPrefix("/users/"), 3)
+	cache.SyncUpdates()
+	assert.Equal(t, cache.Get("/users/1", ".json"), nil)
+	assert.Equal(t, cache.Get("/users/2", ".xml"), nil)
+	assert.Equal(t, cache.Get("/posts/1", ".json").Value(), "d")
+	assert.List(t, cache.Primaries(), []string{"/posts/1"})
+	assert.Equal(t, cache.GetSize(), 1)
+}
+
+func Test_LayeredCache_ConcurrentDeleteGroupAndGC(t *testing.T) {
+	cache := Layered(Configure[int]().MaxSize(50).DeleteBuffer(1).PercentToPrune(90))
+	defer cache.Stop()
+
+	done := make(chan struct{})
+	go func() {
+		for i := 0; i < 1000; i++ {
+			for j := 0; j < 20; j++ {
+				cache.Set("g", strconv.Itoa(j), j, time.Minute)
+			}
+			cache.DeletePrimaryPrefix("g")
+		}
+		close(done)
+	}()
+	for i := 0; i < 20000; i++ {
+		cache.Set("o"+strconv.Itoa(i%100), "a", i, time.Minute)
+	}
+	<-done
+	cache.SyncUpdates()
+	assert.Equal(t, cache.GetSize() <= 50, true)
+}
+
+func Test_LayeredCache_DeleteGroupsFunc(t *testing.T) {
+	cache := newLayered[int]()
+	defer cache.Stop()
+
+	for i := 0; i < 10; i++ {
+		cache.Set(strconv.Itoa(i), "a", i, time.Minute)
+		cache.Set(strconv.Itoa(i), "b", i, time.Minute)
+	}
+	assert.Equal(t, cache.DeleteGroupsFunc(func(primary string) bool {
+		n, _ := strconv.Atoi(primary)
+		return n%2 == 0
+	}), 10)
+	assert.Equal(t, cache.ItemCount(), 10)
+	assert.Equal(t, cache.Get("2", "a"), nil)
+	assert.Equal(t, cache.Get("3", "b").Value(), 3)
+}
+
+func Test_LayeredCache_GenerationalDeleteAll(t *testing.T) {
+	deleted := int32(0)
+	cache := Layered(Configure[string]().Generational().OnDelete(func(item *Item[string]) {
+		atomic.AddInt32(&deleted, 1)
+	}))
+	defer cache.Stop()
+
+	cache.Set("spice", "flow", "value-a", time.Minute)
+	cache.Set("spice", "must", "value-b", time.Minute)
+	cache.Set("leto", "sister", "ghanima", time.Minute)
+	sCache := cache.GetOrCreateSecondaryCache("spice")
+	cache.SyncUpdates()
+
+	assert.Equal(t, cache.DeleteAll("spice"), true)
+	assert.Equal(t, cache.Get("spice", "flow"), nil)
+	assert.Equal(t, cache.GetWithoutPromote("spice", "must"), nil)
+	assert.Equal(t, sCache.Get("flow"), nil)
+	assert.Equal(t, cache.Replace("spice", "flow", "x"), false)
+	assert.Equal(t, cache.Get("leto", "sister").Value(), "ghanima")
+	assert.List(t, forEachKeysLayered(cache, "spice"), []string{})
+
+	// new items are visible
+	cache.Set("spice", "flow", "value-c", time.Minute)
+	assert.Equal(t, cache.Get("spice", "flow").Value(), "value-c")
+	assert.Equal(t, sCache.Get("flow").Value(), "value-c")
+
+	// the worker reclaims the invalidated items
+	cache.SyncUpdates()
+	assert.Equal(t, cache.GetSize(), 2)
+	assert.Equal(t, cache.GroupCount("spice"), 1)
+	assert.Equal(t, atomic.LoadInt32(&deleted), 2)
+
+	assert.Equal(t, cache.DeleteAll("nope"), false)
+}
+
+func Test_LayeredCache_GenerationalInvalidate(t *testing.T) {
+	cache := Layered(Configure[int]().Generational())
+	defer cache.Stop()
+
+	for i := 0; i < 10; i++ {
+		cache.Set(strconv.Itoa(i), "a", i, time.Minute)
+	}
+	cache.SyncUpdates()
+
+	cache.Invalidate()
+	for i := 0; i < 10; i++ {
+		assert.Equal(t, cache.Get(strconv.Itoa(i), "a"), nil)
+	}
+	seen := 0
+	cache.ForEachAll(func(primary string, secondary string, item *Item[int]) bool {
+		seen += 1
+		return true
+	})
+	assert.Equal(t, seen, 0)
+	assert.Equal(t, cache.Delete("1", "a"), false)
+
+	cache.Set("1", "a", 100, time.Minute)
+	assert.Equal(t, cache.Get("1", "a").Value(), 100)
+
+	cache.SyncUpdates()
+	assert.Equal(t, cache.GetSize(), 1)
+	assert.Equal(t, cache.ItemCount(), 1)
+	assert.Equal(t, len(cache.Primaries()), 1)
+}
+
+func Test_LayeredCache_GenerationalDeletesIgnoreStaleItems(t *testing.T) {
+	cache := Layered(Configure[int]().Generational())
+	defer cache.Stop()
+
+	cache.Set("spice", "flow", 1, time.Minute)
+	cache.Set("spice", "must", 2, time.Minute)
+	cache.Set("leto", "flow", 3, time.Minute)
+	cache.SyncUpdates()
+
+	// invalidate the group without asking the worker to reclaim it, so that
+	// the stale items are still in their bucket
+	cache.bucket("spice").invalidate("spice", cache.isStale)
+
+	assert.Equal(t, cache.Delete("spice", "flow"), false)
+	assert.Equal(t, cache.DeleteFunc("spice", func(key string, item *Item[int]) bool {
+		t.Errorf("called with stale item %s", key)
+		return true
+	}), 0)
+	assert.Equal(t, cache.DeletePrefix("spice", "m"), 0)
+	assert.Equal(t, cache.DeleteGroupsFunc(func(primary string) bool {
+		if primary == "spice" {
+			t.Error("called with a stale group")
+		}
+		return false
+	}), 0)
+	assert.Equal(t, cache.DeleteSecondary("must"), 0)
+	assert.Equal(t, cache.DeleteSecondary("flow"), 1)
+	assert.Equal(t, cache.Get("leto", "flow"), nil)
+
+	cache.Set("spice", "flow", 4, time.Minute)
+	assert.Equal(t, cache.DeletePrimaryPrefix("sp"), 1)
+}
+
+func Test_LayeredCache_GenerationalDeleteAllOfAnInvalidatedGroup(t *testing.T) {
+	cache := Layered(Configure[int]().Generational())
+	defer cache.Stop()
+
+	cache.Set("spice", "flow", 1, time.Minute)
+	cache.Set("leto", "flow", 2, time.Minute)
+	cache.SyncUpdates()
+
+	// as in Test_LayeredCache_GenerationalDeletesIgnoreStaleItems, the stale
+	// items stay in their bucket
+	cache.bucket("spice").invalidate("spice", cache.isStale)
+	assert.Equal(t, cache.DeleteAll("spice"), false)
+
+	cache.Set("spice", "must", 3, time.Minute)
+	assert.Equal(t, cache.DeleteAll("spice"), true)
+	assert.Equal(t, cache.DeleteAll("spice"), false)
+}
+
+func Test_LayeredCache_GenerationalPrimariesSkipInvalidatedGroups(t *testing.T) {
+	cache := Layered(Configure[int]().Generational())
+	defer cache.Stop()
+
+	cache.Set("spice", "flow", 1, time.Minute)
+	cache.Set("leto", "flow", 2, time.Minute)
+	cache.SyncUpdates()
+
+	cache.bucket("spice").invalidate("spice", cache.isStale)
+	assert.List(t, cache.Primaries(), []string{"leto"})
+	cache.ForEachGroup(func(primary string, sc *SecondaryCache[int]) bool {
+		assert.Equal(t, primary, "leto")
+		return true
+	})
+
+	atomic.AddUint64(&cache.generation, 1)
+	assert.List(t, cache.Primaries(), []string{})
+}
+
+func Test_LayeredCache_InvalidateWithoutGenerationsClears(t *testing.T) {
+	cache := newLayered[int]()
+	defer cache.Stop()
+
+	cache.Set("a", "b", 1, time.Minute)
+	cache.Invalidate()
+	assert.Equal(t, cache.Get("a", "b"), nil)
+	assert.Equal(t, cache.GetSize(), 0)
+}
+
+func Test_LayeredCache_Iterators(t *testing.T) {
+	cache := Layered(Configure[int]().GetsPerPromote(1))
+	defer cache.Stop()
+
+	cache.Set("p1", "a", 1, time.Minute)
+	cache.Set("p1", "b", 2, time.Minute)
+	cache.Set("p2", "a", 3, time.Minute)
+
+	var keys []string
+	for key, item := range cache.All() {
+		keys = append(keys, item.Group()+":"+key)
+	}
+	sort.Strings(keys)
+	assert.List(t, keys, []string{"p1:a", "p1:b", "p2:a"})
+
+	sum := 0
+	for value := range cache.Values() {
+		sum += value
+	}
+	assert.Equal(t, sum, 6)
+
+	count := 0
+	for range cache.Keys() {
+		count += 1
+	}
+	assert.Equal(t, count, 3)
+
+	sc := cache.GetOrCreateSecondaryCache("p1")
+	keys = nil
+	for key := range sc.Keys() {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	assert.List(t, keys, []string{"a", "b"})
+
+	sum = 0
+	for value := range sc.Values() {
+		sum += value
+	}
+	assert.Equal(t, sum, 3)
+
+	for key := range cache.GetOrCreateSecondaryCache("p3").All() {
+		t.Errorf("unexpected key %s", key)
+	}
+}
+
+func Test_LayeredCache_ByRecency(t *testing.T) {
+	cache := Layered(Configure[int]().GetsPerPromote(1))
+	defer cache.Stop()
+
+	cache.Set("p1", "a", 1, time.Minute)
+	cache.Set("p2", "a", 2, time.Minute)
+	cache.Set("p1", "b", 3, time.Minute)
+	cache.SyncUpdates()
+	cache.Get("p1", "a")
+	cache.SyncUpdates()
+
+	var keys []string
+	for key, item := range cache.ByRecency() {
+		keys = append(keys, item.Group()+":"+key)
+	}
+	assert.List(t, keys, []string{"p1:a", "p1:b", "p2:a"})
+
+	keys = nil
+	for key := range cache.GetOrCreateSecondaryCache("p1").ByRecency() {
+		keys = append(keys, key)
+	}
+	assert.List(t, keys, []string{"a", "b"})
+
+	cache.Delete("p1", "b")
+	keys = nil
+	for key := range cache.GetOrCreateSecondaryCache("p1").ByRecency() {
+		keys = append(keys, key)
+	}
+	assert.List(t, keys, []string{"a"})
+}
+
 func Test_LayeredConcurrentStop(t *testing.T) {
 	for i := 0; i < 100; i++ {
 		cache := Layered(Configure[string]())
@@ -522,3 +1136,13 @@ func forEachKeysLayered[T any](cache *LayeredCache[T], primary string) []string
 	sort.Strings(keys)
 	return keys
 }
+
+func primaryCount[T any](cache *LayeredCache[T]) int {
+	count := 0
+	for _, b := range cache.buckets {
+		b.RLock()
+		count += len(b.buckets)
+		b.RUnlock()
+	}
+	return count
+}
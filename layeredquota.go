@@ -0,0 +1,58 @@
+package ccache
+
+// When MaxGroupSize or MaxGroupItems is configured, the LayeredCache's worker
+// keeps, for each primary key, a list of that group's items (in the same
+// recency order as the cache's main list) along with the group's size and
+// item count. This lets the worker evict a group's own least recently used
+// items when the group goes over its quota, without scanning the main list.
+// Like the main list, this is only ever touched by the worker.
+type groupQuota[T any] struct {
+	head  *Item[T]
+	tail  *Item[T]
+	size  int64
+	count int
+}
+
+func (g *groupQuota[T]) insert(item *Item[T]) {
+	g.size += item.size
+	g.count += 1
+	head := g.head
+	g.head = item
+	if head == nil {
+		g.tail = item
+		return
+	}
+	item.workerState().groupNext = head
+	head.workerState().groupPrev = item
+}
+
+func (g *groupQuota[T]) remove(item *Item[T]) {
+	state := item.workerState()
+	next := state.groupNext
+	prev := state.groupPrev
+
+	if next == nil {
+		g.tail = prev
+	} else {
+		next.state.groupPrev = prev
+	}
+
+	if prev == nil {
+		g.head = next
+	} else {
+		prev.state.groupNext = next
+	}
+	state.groupNext = nil
+	state.groupPrev = nil
+	g.size -= item.size
+	g.count -= 1
+}
+
+func (g *groupQuota[T]) moveToFront(item *Item[T]) {
+	g.remove(item)
+	g.insert(item)
+}
+
+func (g *groupQuota[T]) over(maxSize int64, maxItems int) bool {
+	return (maxSize > 0 && g.size > maxSize) || (maxItems > 0 && g.count > maxItems)
+}
@@ -0,0 +1,313 @@
+package ccache
+
+import (
+	"container/list"
+	"hash/fnv"
+	"math"
+	"sync"
+	"sync/atomic"
+)
+
+const (
+	// keys are sampled when their hash, modulo this, is below the threshold
+	shardsModulus = 1 << 24
+
+	// the most sampled keys that we keep track of
+	shardsMaxSamples = 1 << 14
+
+	// histogram buckets are powers of 2^(1/histogramPrecision)
+	histogramPrecision = 4
+)
+
+// The sizes, relative to the max size, at which MissRatioCurve estimates
+// the hit ratio
+var missRatioSizes = []float64{0.25, 0.5, 1, 2, 4, 8}
+
+// A point of the curve returned by Cache.MissRatioCurve
+type MissRatioPoint struct {
+	// The hypothetical max size
+	Size int64
+
+	// The hit ratio, estimated from the reuse distances of a sample of keys:
+	// the total size of the distinct keys fetched between two gets of the
+	// same key. Both gets would hit a cache that is (at least) that big.
+	HitRatio float64
+
+	// Only for sizes bigger than the max size, the cache's actual hit ratio,
+	// plus the misses which would have been hits had the evicted items been
+	// kept (based on the keys of recently evicted items). This is exact, but
+	// only as far as those keys go, and so only a lower bound for the larger
+	// sizes.
+	GhostHitRatio float64
+}
+
+// Tracks the data needed to estimate a Cache's miss ratio curve (see
+// Configuration.TrackMissRatio). Gets (from any goroutine) and evictions
+// (from the worker) both record into it, so it has its own lock. Only gets of
+// sampled keys, and misses, take it.
+type missRatio struct {
+	gets int64
+	hits int64
+
+	sync.Mutex
+
+	// keys of the items recently evicted by gc, most recent first. evicted is
+	// the total size of the items gc has evicted, and each ghost records what
+	// it was when the ghost's item was evicted.
+	ghosts    map[string]*list.Element
+	ghostList *list.List
+	maxGhosts int
+	evicted   int64
+
+	// by how much bigger the cache would have needed to be, for misses of
+	// keys which had a ghost
+	ghostHits histogram
+
+	// SHARDS: an LRU stack of a sample of keys. Distances within the sample
+	// are scaled by 1/rate.
+	threshold uint64
+	rate      float64
+	samples   reuseStack
+	accesses  int64
+	distances histogram
+}
+
+type missRatioEntry struct {
+	key  string
+	size int64
+	// for ghosts, missRatio.evicted after the item was evicted
+	evicted int64
+	// for samples, the timestamp of the last access
+	at int
+}
+
+// An LRU stack which measures reuse distances in O(log n). Every access is
+// given the next timestamp, and a Fenwick tree holds, at each key's last
+// access, the key's size: the keys accessed since a key's last access are
+// the ones after its timestamp. Timestamps are renumbered once they run out.
+type reuseStack struct {
+	entries map[string]*missRatioEntry
+	// by timestamp, nil if the key was accessed again since, or dropped
+	slots []*missRatioEntry
+	sizes fenwick
+	// the next timestamp
+	clock int
+	// there's no entry before this timestamp
+	oldest int
+}
+
+// Prefix sums of int64s, with O(log n) updates
+type fenwick []int64
+
+// Counts of values in logarithmic buckets
+type histogram [64*histogramPrecision + 1]int64
+
+func newMissRatio(maxGhosts int, rate float64) *missRatio {
+	rate = math.Max(math.Min(rate, 1), 0)
+	return &missRatio{
+		maxGhosts: maxGhosts,
+		ghosts:    make(map[string]*list.Element),
+		ghostList: list.New(),
+		rate:      rate,
+		threshold: uint64(rate * shardsModulus),
+		samples:   reuseStack{entries: make(map[string]*missRatioEntry)},
+	}
+}
+
+// Records a get. size is 0 on a miss.
+func (m *missRatio) get(key string, size int64, hit bool) {
+	atomic.AddInt64(&m.gets, 1)
+	if hit {
+		atomic.AddInt64(&m.hits, 1)
+	}
+	sampled := m.sampled(key)
+	if hit && !sampled {
+		return
+	}
+
+	m.Lock()
+	defer m.Unlock()
+	if !hit {
+		if e := m.ghosts[key]; e != nil {
+			ghost := m.removeGhost(e)
+			m.ghostHits.add(m.evicted - ghost.evicted + ghost.size)
+		}
+	}
+	if sampled {
+		m.access(key, size)
+	}
+}
+
+// Records an item evicted by gc
+func (m *missRatio) evict(key string, size int64) {
+	m.Lock()
+	defer m.Unlock()
+	m.evicted += size
+	if e := m.ghosts[key]; e != nil {
+		m.removeGhost(e)
+	}
+	if m.maxGhosts <= 0 {
+		return
+	}
+	m.ghosts[key] = m.ghostList.PushFront(&missRatioEntry{key: key, size: size, evicted: m.evicted})
+	if m.ghostList.Len() > m.maxGhosts {
+		m.removeGhost(m.ghostList.Back())
+	}
+}
+
+func (m *missRatio) removeGhost(e *list.Element) *missRatioEntry {
+	ghost := m.ghostList.Remove(e).(*missRatioEntry)
+	delete(m.ghosts, ghost.key)
+	return ghost
+}
+
+func (m *missRatio) sampled(key string) bool {
+	h := fnv.New64a()
+	h.Write([]byte(key))
+	return h.Sum64()%shardsModulus < m.threshold
+}
+
+// Records the access of a sampled key. The key's reuse distance is the total
+// size of the sampled keys accessed since its previous access, itself
+// included.
+func (m *missRatio) access(key string, size int64) {
+	m.accesses += 1
+	if distance, reused := m.samples.access(key, size); reused {
+		m.distances.add(int64(float64(distance) / m.rate))
+	}
+}
+
+// Moves the key to the top of the stack, and returns its reuse distance,
+// unless it wasn't in the stack. size is 0 when it's unknown (on a miss).
+func (s *reuseStack) access(key string, size int64) (int64, bool) {
+	entry := s.entries[key]
+	if entry == nil {
+		if size == 0 {
+			size = 1
+		}
+		entry = &missRatioEntry{key: key, size: size}
+		s.entries[key] = entry
+		s.push(entry)
+		if len(s.entries) > shardsMaxSamples {
+			s.dropOldest()
+		}
+		return 0, false
+	}
+
+	// the size of the keys accessed since
+	distance := s.sizes.sum(s.clock) - s.sizes.sum(entry.at+1)
+	s.pop(entry)
+	if size != 0 {
+		entry.size = size
+	}
+	s.push(entry)
+	return distance + entry.size, true
+}
+
+func (s *reuseStack) push(entry *missRatioEntry) {
+	if s.clock == len(s.slots) {
+		s.renumber()
+	}
+	entry.at = s.clock
+	s.slots[entry.at] = entry
+	s.sizes.add(entry.at, entry.size)
+	s.clock += 1
+}
+
+func (s *reuseStack) pop(entry *missRatioEntry) {
+	s.slots[entry.at] = nil
+	s.sizes.add(entry.at, -entry.size)
+}
+
+func (s *reuseStack) dropOldest() {
+	for s.slots[s.oldest] == nil {
+		s.oldest += 1
+	}
+	entry := s.slots[s.oldest]
+	s.pop(entry)
+	delete(s.entries, entry.key)
+}
+
+// Gives the entries consecutive timestamps, from 0, leaving room for as many
+// more accesses. That's O(n), every n accesses (at least).
+func (s *reuseStack) renumber() {
+	slots := make([]*missRatioEntry, max(2*(len(s.entries)+1), 64))
+	sizes := make(fenwick, len(slots))
+	n := 0
+	for _, entry := range s.slots[s.oldest:s.clock] {
+		if entry != nil {
+			entry.at = n
+			slots[n] = entry
+			sizes[n] = entry.size
+			n += 1
+		}
+	}
+	sizes.build()
+	s.slots, s.sizes, s.clock, s.oldest = slots, sizes, n, 0
+}
+
+func (m *missRatio) curve(maxSize int64) []MissRatioPoint {
+	gets := atomic.LoadInt64(&m.gets)
+	hits := atomic.LoadInt64(&m.hits)
+
+	m.Lock()
+	defer m.Unlock()
+	points := make([]MissRatioPoint, len(missRatioSizes))
+	for i, relative := range missRatioSizes {
+		size := int64(float64(maxSize) * relative)
+		point := MissRatioPoint{Size: size}
+		if m.accesses > 0 {
+			point.HitRatio = float64(m.distances.within(size)) / float64(m.accesses)
+		}
+		if size > maxSize && gets > 0 {
+			point.GhostHitRatio = float64(hits+m.ghostHits.within(size-maxSize)) / float64(gets)
+		}
+		points[i] = point
+	}
+	return points
+}
+
+func (f fenwick) add(i int, delta int64) {
+	for i += 1; i <= len(f); i += i & -i {
+		f[i-1] += delta
+	}
+}
+
+// The sum of the first n values
+func (f fenwick) sum(n int) int64 {
+	sum := int64(0)
+	for ; n > 0; n -= n & -n {
+		sum += f[n-1]
+	}
+	return sum
+}
+
+// Turns the values into a tree, in O(n)
+func (f fenwick) build() {
+	for i := 1; i <= len(f); i++ {
+		if parent := i + i&-i; parent <= len(f) {
+			f[parent-1] += f[i-1]
+		}
+	}
+}
+
+func (h *histogram) add(value int64) {
+	index := 0
+	if value > 1 {
+		index = int(math.Ceil(math.Log2(float64(value)) * histogramPrecision))
+	}
+	h[min(index, len(h)-1)] += 1
+}
+
+// The number of values which are certainly no bigger than max. Bucket i holds
+// the (integer) values in (2^((i-1)/precision), 2^(i/precision)].
+func (h *histogram) within(max int64) int64 {
+	count := int64(0)
+	for i, n := range h {
+		if math.Floor(math.Pow(2, float64(i)/histogramPrecision)) > float64(max) {
+			break
+		}
+		count += n
+	}
+	return count
+}
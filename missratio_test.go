@@ -0,0 +1,143 @@
+package ccache
+
+import (
+	"math/rand"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/karlseguin/ccache/v3/assert"
+)
+
+func Test_Histogram(t *testing.T) {
+	var h histogram
+	h.add(0)
+	h.add(1)
+	h.add(8)
+	h.add(9)
+	h.add(1000)
+	assert.Equal(t, h.within(1), 2)
+	assert.Equal(t, h.within(8), 3)
+	assert.Equal(t, h.within(9), 4)
+	assert.Equal(t, h.within(10), 4)
+	assert.Equal(t, h.within(999), 4)
+	assert.Equal(t, h.within(2000), 5)
+}
+
+func Test_MissRatio_GhostHits(t *testing.T) {
+	m := newMissRatio(2, 0)
+	m.evict("a", 3)
+	m.evict("b", 2)
+	m.evict("c", 1)
+
+	// only the last 2 ghosts are kept
+	assert.Equal(t, len(m.ghosts), 2)
+	m.get("a", 0, false)
+	assert.Equal(t, m.ghostHits.within(1000), 0)
+
+	// b would have been a hit with 3 more
+	m.get("b", 0, false)
+	assert.Equal(t, m.ghostHits.within(2), 0)
+	assert.Equal(t, m.ghostHits.within(3), 1)
+	assert.Equal(t, len(m.ghosts), 1)
+
+	m.get("c", 1, true)
+	points := m.curve(10)
+	assert.Equal(t, points[3].Size, 20)
+	assert.Equal(t, points[3].GhostHitRatio, 2.0/3.0)
+	assert.Equal(t, points[2].GhostHitRatio, 0)
+}
+
+func Test_MissRatio_ReuseDistances(t *testing.T) {
+	m := newMissRatio(0, 1)
+	for i := 0; i < 3; i++ {
+		for j := 0; j < 8; j++ {
+			m.get(strconv.Itoa(j), 2, true)
+		}
+	}
+	// every reuse is 8 keys of size 2 apart
+	points := m.curve(16)
+	assert.Equal(t, points[1].Size, 8)
+	assert.Equal(t, points[1].HitRatio, 0)
+	assert.Equal(t, points[2].Size, 16)
+	assert.Equal(t, points[2].HitRatio, 16.0/24.0)
+	assert.Equal(t, points[3].GhostHitRatio, 1)
+}
+
+func Test_ReuseStack_MatchesLinearWalk(t *testing.T) {
+	s := reuseStack{entries: make(map[string]*missRatioEntry)}
+	// the keys, most recently accessed first, and their sizes
+	var keys []string
+	sizes := make(map[string]int64)
+
+	r := rand.New(rand.NewSource(1))
+	for i := 0; i < 20000; i++ {
+		key := strconv.Itoa(r.Intn(500))
+		size := int64(r.Intn(4))
+
+		expected, found := int64(0), false
+		for j, k := range keys {
+			if k == key {
+				keys = append(keys[:j], keys[j+1:]...)
+				found = true
+				break
+			}
+			expected += sizes[k]
+		}
+		if size != 0 {
+			sizes[key] = size
+		} else if !found {
+			sizes[key] = 1
+		}
+		keys = append([]string{key}, keys...)
+
+		distance, reused := s.access(key, size)
+		assert.Equal(t, reused, found)
+		if found {
+			assert.Equal(t, distance, expected+sizes[key])
+		}
+	}
+}
+
+func Test_ReuseStack_DropsTheLeastRecentlyUsed(t *testing.T) {
+	s := reuseStack{entries: make(map[string]*missRatioEntry)}
+	for i := 0; i <= shardsMaxSamples; i++ {
+		s.access(strconv.Itoa(i), 1)
+	}
+	assert.Equal(t, len(s.entries), shardsMaxSamples)
+
+	distance, reused := s.access("1", 1)
+	assert.Equal(t, reused, true)
+	assert.Equal(t, distance, shardsMaxSamples)
+	_, reused = s.access("0", 1)
+	assert.Equal(t, reused, false)
+}
+
+func Test_CacheMissRatioCurve(t *testing.T) {
+	cache := New(Configure[int]().MaxSize(10).TrackMissRatio(100, 1))
+	defer cache.Stop()
+
+	for i := 0; i < 3; i++ {
+		for j := 0; j < 20; j++ {
+			key := strconv.Itoa(j)
+			if cache.Get(key) == nil {
+				cache.Set(key, j, time.Minute)
+			}
+			cache.SyncUpdates()
+		}
+	}
+
+	points := cache.MissRatioCurve()
+	assert.Equal(t, len(points), 6)
+	assert.Equal(t, points[2].Size, 10)
+	assert.Equal(t, points[2].HitRatio, 0)
+	assert.Equal(t, points[4].Size, 40)
+	assert.Equal(t, points[4].HitRatio, 40.0/60.0)
+	assert.Equal(t, points[4].GhostHitRatio, 40.0/60.0)
+}
+
+func Test_CacheMissRatioCurveWhenNotTracked(t *testing.T) {
+	cache := New(Configure[int]())
+	defer cache.Stop()
+	assert.Nil(t, cache.MissRatioCurve())
+}
@@ -0,0 +1,76 @@
+package ccache
+
+// Decides the order in which a Cache's worker evicts items. Only the worker
+// uses a policy, so implementations don't need to be thread-safe.
+type evictionPolicy[T any] interface {
+	// A new item was added to the cache
+	insert(item *Item[T])
+
+	// An item in the cache was promoted (it was fetched GetsPerPromote times)
+	promote(item *Item[T])
+
+	// An item was removed from the cache
+	remove(item *Item[T])
+
+	// Calls fn with items, in the order they should be evicted, until fn returns
+	// false. fn is free to remove the item it's called with.
+	victims(fn func(item *Item[T]) bool)
+
+	// Calls fn with items, from the one most worth keeping to the next one to
+	// be evicted, until fn returns false.
+	keepers(fn func(item *Item[T]) bool)
+}
+
+// The default policy: LRU, but with one list per priority. Lower priorities
+// are evicted first, and items are evicted in LRU order within a priority.
+// When every item has the same priority, this is a plain LRU.
+type priorityLists[T any] struct {
+	lists [priorityCount]*List[T]
+}
+
+func newPriorityLists[T any]() evictionPolicy[T] {
+	p := &priorityLists[T]{}
+	for i := range p.lists {
+		p.lists[i] = NewList[T]()
+	}
+	return p
+}
+
+func (p *priorityLists[T]) list(item *Item[T]) *List[T] {
+	return p.lists[item.priority-PriorityLow]
+}
+
+func (p *priorityLists[T]) insert(item *Item[T]) {
+	p.list(item).Insert(item)
+}
+
+func (p *priorityLists[T]) promote(item *Item[T]) {
+	p.list(item).MoveToFront(item)
+}
+
+func (p *priorityLists[T]) remove(item *Item[T]) {
+	p.list(item).Remove(item)
+}
+
+func (p *priorityLists[T]) victims(fn func(item *Item[T]) bool) {
+	for _, list := range p.lists {
+		item := list.Tail
+		for item != nil {
+			prev := item.prev
+			if !fn(item) {
+				return
+			}
+			item = prev
+		}
+	}
+}
+
+func (p *priorityLists[T]) keepers(fn func(item *Item[T]) bool) {
+	for i := len(p.lists) - 1; i >= 0; i-- {
+		for item := p.lists[i].Head; item != nil; item = item.next {
+			if !fn(item) {
+				return
+			}
+		}
+	}
+}
@@ -0,0 +1,20 @@
+package ccache
+
+// The priority of a Cache's item. When the cache is full, items with a lower
+// priority are evicted first. Within a priority, items are evicted in LRU
+// order.
+type Priority int8
+
+const (
+	// For items which are cheap to recompute
+	PriorityLow Priority = -1
+
+	// The priority of items set without one
+	PriorityNormal Priority = 0
+
+	// For items which are expensive to recompute, and which should survive
+	// bursts of cheaper traffic
+	PriorityHigh Priority = 1
+
+	priorityCount = int(PriorityHigh-PriorityLow) + 1
+)
@@ -1,27 +1,30 @@
 package ccache
 
-import "time"
+import (
+	"iter"
+	"time"
+)
 
 type SecondaryCache[T any] struct {
-	bucket *bucket[T]
-	pCache *LayeredCache[T]
+	primary string
+	bucket  *bucket[T]
+	pCache  *LayeredCache[T]
 }
 
 // Get the secondary key.
 // The semantics are the same as for LayeredCache.Get
 func (s *SecondaryCache[T]) Get(secondary string) *Item[T] {
-	return s.bucket.get(secondary)
+	bucket := s.current()
+	if bucket == nil {
+		return nil
+	}
+	return s.pCache.visible(bucket, bucket.get(secondary))
 }
 
 // Set the secondary key to a value.
 // The semantics are the same as for LayeredCache.Set
 func (s *SecondaryCache[T]) Set(secondary string, value T, duration time.Duration) *Item[T] {
-	item, existing := s.bucket.set(secondary, value, duration, false)
-	if existing != nil {
-		s.pCache.deletables <- existing
-	}
-	s.pCache.promote(item)
-	return item
+	return s.pCache.set(s.primary, secondary, value, duration, false)
 }
 
 // Fetch or set a secondary key.
@@ -41,12 +44,7 @@ func (s *SecondaryCache[T]) Fetch(secondary string, duration time.Duration, fetc
 // Delete a secondary key.
 // The semantics are the same as for LayeredCache.Delete
 func (s *SecondaryCache[T]) Delete(secondary string) bool {
-	item := s.bucket.remove(secondary)
-	if item != nil {
-		s.pCache.deletables <- item
-		return true
-	}
-	return false
+	return s.pCache.Delete(s.primary, secondary)
 }
 
 // Replace a secondary key.
@@ -70,3 +68,73 @@ func (c *SecondaryCache[T]) TrackingGet(secondary string) TrackedItem[T] {
 	item.track()
 	return item
 }
+
+// Iterates over the primary key's items, in random order. The items are copied
+// while holding the group's read lock, which is released before any of them
+// are yielded, so the loop's body is free to use the cache. Items set or deleted
+// during the iteration may or may not be seen.
+func (s *SecondaryCache[T]) All() iter.Seq2[string, *Item[T]] {
+	return func(yield func(string, *Item[T]) bool) {
+		bucket := s.current()
+		if bucket == nil {
+			return
+		}
+		for _, item := range bucket.items() {
+			if s.pCache.isStale(bucket, item) {
+				continue
+			}
+			if !yield(item.key, item) {
+				return
+			}
+		}
+	}
+}
+
+// The secondary keys of the primary key's items. Same semantics as All.
+func (s *SecondaryCache[T]) Keys() iter.Seq[string] {
+	return func(yield func(string) bool) {
+		for key := range s.All() {
+			if !yield(key) {
+				return
+			}
+		}
+	}
+}
+
+// The values of the primary key's items. Same semantics as All.
+func (s *SecondaryCache[T]) Values() iter.Seq[T] {
+	return func(yield func(T) bool) {
+		for _, item := range s.All() {
+			if !yield(item.value) {
+				return
+			}
+		}
+	}
+}
+
+// Iterates over the primary key's items, from the most to the least recently
+// used. Same semantics as Cache.ByRecency, except that the worker's copy is of
+// the entire cache's list, which is then filtered down to this primary key.
+func (s *SecondaryCache[T]) ByRecency() iter.Seq2[string, *Item[T]] {
+	return func(yield func(string, *Item[T]) bool) {
+		for _, item := range s.pCache.recencySnapshot() {
+			if item.group != s.primary || s.Get(item.key) != item {
+				continue
+			}
+			if !yield(item.key, item) {
+				return
+			}
+		}
+	}
+}
+
+// Once empty, the bucket we were created with can be reclaimed by the
+// LayeredCache (and if the primary key had no items, we weren't created with
+// one). From then on, we need to go through the LayeredCache to get the
+// primary key's current bucket, if there is one.
+func (s *SecondaryCache[T]) current() *bucket[T] {
+	if s.bucket != nil && !s.bucket.isReclaimed() {
+		return s.bucket
+	}
+	return s.pCache.bucket(s.primary).getSecondaryBucket(s.primary)
+}
@@ -114,3 +114,21 @@ func Test_SecondaryCache_TrackerDoesNotCleanupHeldInstance(t *testing.T) {
 	cache.GC()
 	assert.Equal(t, cache.Get("0", "a"), nil)
 }
+
+func Test_SecondaryCache_DoesNotCreateGroupsOnRead(t *testing.T) {
+	cache := newLayered[string]()
+	for i := 0; i < 100; i++ {
+		sCache := cache.GetOrCreateSecondaryCache("user:" + strconv.Itoa(i))
+		assert.Equal(t, sCache.Get("x"), nil)
+		assert.Equal(t, sCache.Delete("x"), false)
+	}
+	assert.Equal(t, len(cache.Primaries()), 0)
+	for _, lb := range cache.buckets {
+		assert.Equal(t, len(lb.buckets), 0)
+	}
+
+	sCache := cache.GetOrCreateSecondaryCache("user:1")
+	sCache.Set("x", "a", time.Minute)
+	assert.Equal(t, sCache.Get("x").Value(), "a")
+	assert.Equal(t, cache.Get("user:1", "x").Value(), "a")
+}
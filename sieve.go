@@ -0,0 +1,120 @@
+package ccache
+
+// SIEVE (see Configuration.Sieve). Items are kept in insertion order, and
+// never move. A hand sweeps from the oldest item to the newest (wrapping
+// around): items which were visited (fetched) since the hand last passed them
+// are kept, and have their visited bit cleared, the first item which wasn't is
+// evicted. The hand stays where it stopped.
+type sieve[T any] struct {
+	list  *List[T]
+	hand  *Item[T]
+	count int
+}
+
+func newSieve[T any]() evictionPolicy[T] {
+	return &sieve[T]{list: NewList[T]()}
+}
+
+func (s *sieve[T]) insert(item *Item[T]) {
+	s.list.Insert(item)
+	s.count += 1
+}
+
+// Gets don't promote, they set the item's visited bit
+func (s *sieve[T]) promote(item *Item[T]) {
+}
+
+func (s *sieve[T]) remove(item *Item[T]) {
+	if s.hand == item {
+		s.hand = item.prev
+	}
+	s.list.Remove(item)
+	s.count -= 1
+}
+
+func (s *sieve[T]) victims(fn func(item *Item[T]) bool) {
+	// Every item gets at most two looks: if the first one only clears its
+	// visited bit, the second one will offer it to fn. This keeps us from
+	// sweeping forever when nothing can be evicted.
+	for steps := 2 * s.count; steps > 0 && s.list.Tail != nil; steps-- {
+		item := s.hand
+		if item == nil {
+			item = s.list.Tail
+		}
+		if item.visited() {
+			item.unvisit()
+			s.hand = item.prev
+			continue
+		}
+		// move the hand first, fn might remove the item
+		s.hand = item.prev
+		if !fn(item) {
+			if item.inList {
+				// not evicted, the next sweep starts from it
+				s.hand = item
+			}
+			return
+		}
+	}
+}
+
+func (s *sieve[T]) keepers(fn func(item *Item[T]) bool) {
+	for item := s.list.Head; item != nil; item = item.next {
+		if !fn(item) {
+			return
+		}
+	}
+}
+
+// CLOCK (see Configuration.Clock). The oldest item is the next candidate. If
+// it was visited since it was last looked at, its visited bit is cleared and
+// it's moved to the front, as if it was new. Otherwise, it's evicted.
+type clock[T any] struct {
+	list  *List[T]
+	count int
+}
+
+func newClock[T any]() evictionPolicy[T] {
+	return &clock[T]{list: NewList[T]()}
+}
+
+func (c *clock[T]) insert(item *Item[T]) {
+	c.list.Insert(item)
+	c.count += 1
+}
+
+// Gets don't promote, they set the item's visited bit
+func (c *clock[T]) promote(item *Item[T]) {
+}
+
+func (c *clock[T]) remove(item *Item[T]) {
+	c.list.Remove(item)
+	c.count -= 1
+}
+
+func (c *clock[T]) victims(fn func(item *Item[T]) bool) {
+	// Same bound as sieve's. Items which fn doesn't evict are also moved to the
+	// front, so that we get to the ones behind them.
+	for steps := 2 * c.count; steps > 0 && c.list.Tail != nil; steps-- {
+		item := c.list.Tail
+		if item.visited() {
+			item.unvisit()
+			c.list.MoveToFront(item)
+			continue
+		}
+		if !fn(item) {
+			return
+		}
+		if item.inList {
+			c.list.MoveToFront(item)
+		}
+	}
+}
+
+func (c *clock[T]) keepers(fn func(item *Item[T]) bool) {
+	for item := c.list.Head; item != nil; item = item.next {
+		if !fn(item) {
+			return
+		}
+	}
+}
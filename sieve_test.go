@@ -0,0 +1,87 @@
+package ccache
+
+import (
+	"strconv"
+	"testing"
+
+	"github.com/karlseguin/ccache/v3/assert"
+)
+
+func Test_Sieve_EvictsUnvisitedItems(t *testing.T) {
+	s := newSieve[int]().(*sieve[int])
+	items := policyItems(s, 5)
+	items[0].visit()
+	items[1].visit()
+	items[3].visit()
+
+	// 0 and 1 are kept (and their visited bit cleared), 2 is evicted
+	assert.Equal(t, policyEvict(s), "2")
+	assert.Equal(t, items[0].visited(), false)
+	assert.Equal(t, items[1].visited(), false)
+
+	// the hand resumes from where it stopped: 3 is kept, 4 is evicted
+	assert.Equal(t, policyEvict(s), "4")
+
+	// and wraps around, items don't move
+	assert.Equal(t, policyEvict(s), "0")
+	assert.List(t, policyKeepers(s), []string{"3", "1"})
+}
+
+func Test_Sieve_StopsWhenNothingCanBeEvicted(t *testing.T) {
+	s := newSieve[int]().(*sieve[int])
+	items := policyItems(s, 3)
+	items[1].visit()
+
+	seen := 0
+	s.victims(func(item *Item[int]) bool {
+		seen += 1
+		return true
+	})
+	assert.Equal(t, seen, 5)
+	assert.Equal(t, items[1].visited(), false)
+}
+
+func Test_Clock_ReinsertsVisitedItems(t *testing.T) {
+	c := newClock[int]().(*clock[int])
+	items := policyItems(c, 4)
+	items[0].visit()
+	items[2].visit()
+
+	assert.Equal(t, policyEvict(c), "1")
+	assert.List(t, policyKeepers(c), []string{"0", "3", "2"})
+	// 2 is still visited, and goes back to the front
+	assert.Equal(t, policyEvict(c), "3")
+	assert.Equal(t, policyEvict(c), "0")
+	assert.Equal(t, policyEvict(c), "2")
+	assert.Equal(t, c.count, 0)
+}
+
+// inserts count items, keyed "0" (the oldest) to "count-1"
+func policyItems(p evictionPolicy[int], count int) []*Item[int] {
+	items := make([]*Item[int], count)
+	for i := range items {
+		items[i] = newItem(strconv.Itoa(i), i, 0, false)
+		p.insert(items[i])
+	}
+	return items
+}
+
+// evicts, and returns the key of, the first victim
+func policyEvict(p evictionPolicy[int]) string {
+	var key string
+	p.victims(func(item *Item[int]) bool {
+		key = item.key
+		p.remove(item)
+		return false
+	})
+	return key
+}
+
+func policyKeepers(p evictionPolicy[int]) []string {
+	keys := make([]string, 0)
+	p.keepers(func(item *Item[int]) bool {
+		keys = append(keys, item.key)
+		return true
+	})
+	return keys
+}
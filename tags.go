@@ -0,0 +1,65 @@
+package ccache
+
+import "sync"
+
+// Maps each tag to the items currently stored with it. The index is a bucket
+// observer, so it's updated under the item's bucket write lock and always
+// mirrors what's in the buckets: an item is in the index for as long as it's
+// in its bucket's lookup, no matter how it's removed (Delete, a Set for the
+// same key, DeletePrefix, gc, Clear, ...).
+type tagIndex[T any] struct {
+	sync.Mutex
+	tags map[string]map[*Item[T]]struct{}
+}
+
+func newTagIndex[T any]() *tagIndex[T] {
+	return &tagIndex[T]{tags: make(map[string]map[*Item[T]]struct{})}
+}
+
+func (t *tagIndex[T]) added(item *Item[T]) {
+	tags := item.Tags()
+	if len(tags) == 0 {
+		return
+	}
+	t.Lock()
+	for _, tag := range tags {
+		items := t.tags[tag]
+		if items == nil {
+			items = make(map[*Item[T]]struct{})
+			t.tags[tag] = items
+		}
+		items[item] = struct{}{}
+	}
+	t.Unlock()
+}
+
+func (t *tagIndex[T]) removed(item *Item[T]) {
+	tags := item.Tags()
+	if len(tags) == 0 {
+		return
+	}
+	t.Lock()
+	for _, tag := range tags {
+		items := t.tags[tag]
+		if items == nil {
+			continue
+		}
+		delete(items, item)
+		if len(items) == 0 {
+			delete(t.tags, tag)
+		}
+	}
+	t.Unlock()
+}
+
+// A snapshot of the items currently tagged with tag
+func (t *tagIndex[T]) items(tag string) []*Item[T] {
+	t.Lock()
+	defer t.Unlock()
+	tagged := t.tags[tag]
+	items := make([]*Item[T], 0, len(tagged))
+	for item := range tagged {
+		items = append(items, item)
+	}
+	return items
+}
@@ -0,0 +1,77 @@
+package ccache
+
+import "sync"
+
+// A named index on cached values, registered with Configuration.Index. Maps
+// each value returned by the index's extract function to the items it was
+// extracted from. Like the tag index, it's a bucket observer, so it always
+// mirrors the buckets' lookups. The extracted values are remembered per item,
+// so that an item is removed from exactly the entries it was added to.
+type valueIndex[T any] struct {
+	sync.Mutex
+	extract func(value T) []string
+	entries map[string]map[*Item[T]]struct{}
+	values  map[*Item[T]][]string
+}
+
+func newValueIndex[T any](extract func(value T) []string) *valueIndex[T] {
+	return &valueIndex[T]{
+		extract: extract,
+		entries: make(map[string]map[*Item[T]]struct{}),
+		values:  make(map[*Item[T]][]string),
+	}
+}
+
+func (v *valueIndex[T]) added(item *Item[T]) {
+	values := v.extract(item.value)
+	if len(values) == 0 {
+		return
+	}
+	v.Lock()
+	v.values[item] = values
+	for _, value := range values {
+		items := v.entries[value]
+		if items == nil {
+			items = make(map[*Item[T]]struct{})
+			v.entries[value] = items
+		}
+		items[item] = struct{}{}
+	}
+	v.Unlock()
+}
+
+func (v *valueIndex[T]) removed(item *Item[T]) {
+	v.Lock()
+	values, exists := v.values[item]
+	if !exists {
+		v.Unlock()
+		return
+	}
+	delete(v.values, item)
+	for _, value := range values {
+		items := v.entries[value]
+		if items == nil {
+			continue
+		}
+		delete(items, item)
+		if len(items) == 0 {
+			delete(v.entries, value)
+		}
+	}
+	v.Unlock()
+}
+
+// A snapshot of the items indexed under value
+func (v *valueIndex[T]) items(value string) []*Item[T] {
+	v.Lock()
+	defer v.Unlock()
+	indexed := v.entries[value]
+	if len(indexed) == 0 {
+		return nil
+	}
+	items := make([]*Item[T], 0, len(indexed))
+	for item := range indexed {
+		items = append(items, item)
+	}
+	return items
+}
@@ -0,0 +1,330 @@
+package ccache
+
+import (
+	"sync/atomic"
+	"time"
+)
+
+// The part of a cache's worker which doesn't depend on the kind of cache,
+// shared by Cache, LayeredCache and HierarchicalCache. It owns the eviction
+// policy, the expiries heap (with the PruneExpiredFirst() option) and the
+// cache's size, and runs the loop which processes promotions, deletions and
+// control messages. Only the worker goroutine touches it, except for the
+// channels.
+type cacheWorker[T any] struct {
+	cache           workerCache[T]
+	config          *Configuration[T]
+	commands        control
+	newPolicy       func() evictionPolicy[T]
+	policy          evictionPolicy[T]
+	expiries        *expiries[T]
+	member          *budgetMember
+	size            int64
+	pruneTargetSize int64
+	dropped         int
+	deletables      chan *Item[T]
+	promotables     chan *Item[T]
+	stopped         chan struct{}
+
+	// called with every item gc evicts (when set). Like dropped, it doesn't
+	// see the items evicted by evictOldest, shrinkTo or purgeExpired
+	collected func(item *Item[T])
+}
+
+// What the worker needs from the cache
+type workerCache[T any] interface {
+	// Processes a get or a set of the item (see cacheWorker.track). Returns
+	// whether the item was added.
+	doPromote(item *Item[T]) bool
+
+	// Processes the deletion of an item which was already removed from the
+	// cache's lookup
+	doDelete(item *Item[T])
+
+	// Whether the item can be evicted
+	evictable(item *Item[T]) bool
+
+	// Removes the item from the cache's lookup and from the worker (see
+	// cacheWorker.untrack)
+	evict(item *Item[T])
+
+	// Handles the control messages which are specific to the cache
+	handle(msg interface{})
+
+	// Called after each promotion, deletion or control message
+	processed()
+}
+
+func newCacheWorker[T any](cache workerCache[T], config *Configuration[T], commands control, newPolicy func() evictionPolicy[T]) cacheWorker[T] {
+	w := cacheWorker[T]{
+		cache:           cache,
+		config:          config,
+		commands:        commands,
+		newPolicy:       newPolicy,
+		policy:          newPolicy(),
+		deletables:      make(chan *Item[T], config.deleteBuffer),
+		promotables:     make(chan *Item[T], config.promoteBuffer),
+		stopped:         make(chan struct{}),
+		pruneTargetSize: config.maxSize - config.maxSize*int64(config.percentToPrune)/100,
+	}
+	if config.budget != nil {
+		w.member = config.budget.join(config.budgetWeight, config.budgetMinSize, commands)
+	}
+	if config.expiredFirst {
+		w.expiries = newExpiries[T]()
+	}
+	return w
+}
+
+// Starts the worker goroutine (and the governor's, if one is configured)
+func (w *cacheWorker[T]) start() {
+	go w.run()
+	if governor := w.config.governor; governor != nil {
+		go governor.run(w.commands, w.stopped, w.config.maxSize)
+	}
+}
+
+func (w *cacheWorker[T]) run() {
+	defer close(w.stopped)
+	if w.member != nil {
+		defer w.member.budget.leave(w.member)
+	}
+
+	for {
+		select {
+		case item := <-w.promotables:
+			w.promote(item)
+		case item := <-w.deletables:
+			w.cache.doDelete(item)
+		case control := <-w.commands:
+			switch msg := control.(type) {
+			case controlStop:
+				goto drain
+			case controlGetDropped:
+				msg.res <- w.dropped
+				w.dropped = 0
+			case controlSetMaxSize:
+				w.config.maxSize = msg.size
+				w.pruneTargetSize = msg.size - msg.size*int64(w.config.percentToPrune)/100
+				if w.size > w.config.maxSize {
+					w.gc()
+				}
+				msg.done <- struct{}{}
+			case controlGetSize:
+				msg.res <- w.size
+			case controlGC:
+				w.gc()
+				msg.done <- struct{}{}
+			case controlSyncUpdates:
+				doAllPendingPromotesAndDeletes(w.promotables, w.promote, w.deletables, w.cache.doDelete)
+				msg.done <- struct{}{}
+			case controlEvictOldest:
+				msg.res <- w.evictOldest(msg.count)
+			case controlShrinkTo:
+				msg.res <- w.shrinkTo(msg.size)
+			case controlPurgeExpired:
+				msg.res <- w.purgeExpired()
+			case controlRecency:
+				msg.res.(chan []*Item[T]) <- w.recency()
+			case controlBudgetGC:
+				w.gc()
+			default:
+				w.cache.handle(msg)
+			}
+		}
+		w.cache.processed()
+		if w.member != nil {
+			w.member.setSize(w.size)
+		}
+	}
+
+drain:
+	for {
+		select {
+		case item := <-w.deletables:
+			w.cache.doDelete(item)
+		default:
+			return
+		}
+	}
+}
+
+func (w *cacheWorker[T]) promote(item *Item[T]) {
+	if w.cache.doPromote(item) && w.full() {
+		w.gc()
+	}
+}
+
+// Adds the item, or, every getsPerPromote gets, promotes it. Returns whether
+// it was added, and whether it was promoted.
+func (w *cacheWorker[T]) track(item *Item[T]) (bool, bool) {
+	// already deleted
+	if item.promotions == -2 {
+		return false, false
+	}
+
+	if item.inList {
+		if item.shouldPromote(w.config.getsPerPromote) {
+			w.policy.promote(item)
+			item.promotions = 0
+			return false, true
+		}
+		return false, false
+	}
+
+	w.size += item.size
+	w.policy.insert(item)
+	if w.expiries != nil {
+		w.expiries.push(item)
+	}
+	return true, false
+}
+
+// Forgets about an item which was added
+func (w *cacheWorker[T]) untrack(item *Item[T]) {
+	w.size -= item.size
+	w.policy.remove(item)
+	if w.expiries != nil {
+		w.expiries.remove(item)
+	}
+}
+
+// Forgets about every item, when the cache is cleared
+func (w *cacheWorker[T]) reset() {
+	w.size = 0
+	w.policy = w.newPolicy()
+	if w.expiries != nil {
+		w.expiries = newExpiries[T]()
+	}
+}
+
+func (w *cacheWorker[T]) gc() {
+	prunedSize := int64(0)
+	sizeToPrune := w.size - w.pruneTargetSize
+	if w.member != nil {
+		sizeToPrune = w.member.sizeToPrune(w.size, w.config.percentToPrune)
+	}
+
+	collect := func(item *Item[T]) {
+		prunedSize += item.size
+		w.cache.evict(item)
+		if w.collected != nil {
+			w.collected(item)
+		}
+		w.dropped += 1
+	}
+
+	if w.expiries != nil {
+		var held []*Item[T]
+		now := time.Now().UnixNano()
+		for prunedSize < sizeToPrune {
+			item := w.expiries.popExpired(now)
+			if item == nil {
+				break
+			}
+			if !w.cache.evictable(item) {
+				held = append(held, item)
+				continue
+			}
+			collect(item)
+		}
+		for _, item := range held {
+			w.expiries.push(item)
+		}
+	}
+
+	w.policy.victims(func(item *Item[T]) bool {
+		if prunedSize >= sizeToPrune {
+			return false
+		}
+		if w.cache.evictable(item) {
+			collect(item)
+		}
+		return true
+	})
+}
+
+// Whether the cache has grown past its max size (or its budget)
+func (w *cacheWorker[T]) full() bool {
+	if w.member != nil {
+		return w.member.full(w.size)
+	}
+	return w.size > w.config.maxSize
+}
+
+func (w *cacheWorker[T]) evictOldest(count int) int {
+	evicted := 0
+	w.policy.victims(func(item *Item[T]) bool {
+		if evicted >= count {
+			return false
+		}
+		if w.cache.evictable(item) {
+			w.cache.evict(item)
+			evicted += 1
+		}
+		return true
+	})
+	return evicted
+}
+
+func (w *cacheWorker[T]) shrinkTo(size int64) int {
+	evicted := 0
+	w.policy.victims(func(item *Item[T]) bool {
+		if w.size <= size {
+			return false
+		}
+		if w.cache.evictable(item) {
+			w.cache.evict(item)
+			evicted += 1
+		}
+		return true
+	})
+	return evicted
+}
+
+func (w *cacheWorker[T]) purgeExpired() int {
+	evicted := 0
+	now := time.Now().UnixNano()
+
+	if w.expiries != nil {
+		var held []*Item[T]
+		for item := w.expiries.popExpired(now); item != nil; item = w.expiries.popExpired(now) {
+			if w.cache.evictable(item) {
+				w.cache.evict(item)
+				evicted += 1
+			} else {
+				held = append(held, item)
+			}
+		}
+		for _, item := range held {
+			w.expiries.push(item)
+		}
+		return evicted
+	}
+
+	// Walking the victims would have side effects (SIEVE and CLOCK clear the
+	// visited bit of the items they pass, ARC remembers the evicted keys), so
+	// the expired items are collected from the keepers, and then evicted.
+	var expired []*Item[T]
+	w.policy.keepers(func(item *Item[T]) bool {
+		if atomic.LoadInt64(&item.expires) < now && w.cache.evictable(item) {
+			expired = append(expired, item)
+		}
+		return true
+	})
+	for _, item := range expired {
+		w.cache.evict(item)
+	}
+	return len(expired)
+}
+
+// A copy of the items, from the one most worth keeping to the next one to be
+// evicted
+func (w *cacheWorker[T]) recency() []*Item[T] {
+	var items []*Item[T]
+	w.policy.keepers(func(item *Item[T]) bool {
+		items = append(items, item)
+		return true
+	})
+	return items
+}